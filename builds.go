@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	buildLimit = 10000
+	buildFile  = "builds.log"
+
+	buildQueued = "queued"
+)
+
+// Build is a single build triggered by Lanky or reported by Jenkins.
+type Build struct {
+	Id          int64
+	Job         string
+	Repository  string
+	Branch      string
+	Sha         string
+	Pusher      string
+	PullRequest int
+	Number      int
+	Status      string
+	QueueUrl    string
+	ConsoleUrl  string
+	QueuedAt    time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// Duration is how long the build ran, zero until it has finished.
+func (b *Build) Duration() time.Duration {
+	if b.StartedAt.IsZero() || b.FinishedAt.IsZero() {
+		return 0
+	}
+	return b.FinishedAt.Sub(b.StartedAt)
+}
+
+// ShortSha is the abbreviated commit shown in listings.
+func (b *Build) ShortSha() string {
+	if len(b.Sha) > 7 {
+		return b.Sha[:7]
+	}
+	return b.Sha
+}
+
+type BuildFilter struct {
+	Repository string
+	Branch     string
+	Status     string
+	Limit      int
+}
+
+func (f *BuildFilter) Match(b *Build) bool {
+	return (f.Repository == "" || f.Repository == b.Repository) &&
+		(f.Branch == "" || f.Branch == b.Branch) &&
+		(f.Status == "" || f.Status == b.Status)
+}
+
+// BuildStore records the history of every build.
+type BuildStore interface {
+	// Record stores a newly triggered build and assigns its Id.
+	Record(b *Build) error
+	// Notify applies a Jenkins notification to the matching build.
+	Notify(n *JenkinsNotification, at time.Time) error
+	// List returns the most recent builds matching the filter, newest first.
+	List(f *BuildFilter) ([]Build, error)
+}
+
+// NewBuildStore returns a file-backed store when DatabaseUrl is set and nil
+// otherwise, leaving Lanky stateless.
+func NewBuildStore(config *Config) (BuildStore, error) {
+	if config.DatabaseUrl == "" {
+		return nil, nil
+	}
+
+	dir, err := config.DatabasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenFileBuildStore(filepath.Join(dir, buildFile), buildLimit)
+}
+
+// recordBuild stores a build Lanky has queued in Jenkins. Failing to record
+// history is logged rather than failing the build.
+func recordBuild(builds BuildStore, build *BuildRequest, location string) {
+	if builds == nil {
+		return
+	}
+
+	err := builds.Record(&Build{
+		Job:         build.Job,
+		Repository:  build.Repository,
+		Branch:      build.Branch,
+		Sha:         build.Sha,
+		Pusher:      build.Pusher,
+		PullRequest: build.PullRequest,
+		Status:      buildQueued,
+		QueueUrl:    location,
+		QueuedAt:    time.Now(),
+	})
+	if err != nil {
+		glog.Errorf("Unable to record build of %v: %v", build.Job, err)
+	}
+}
+
+// FileBuildStore keeps recent builds in memory and appends every change to a
+// JSON lines log. The last entry for an Id wins when the log is replayed.
+type FileBuildStore struct {
+	sync.RWMutex
+	path   string
+	file   *os.File
+	limit  int
+	nextId int64
+	builds []*Build
+	byId   map[int64]*Build
+	// lines written to the log since it was last compacted.
+	lines int
+}
+
+func OpenFileBuildStore(path string, limit int) (*FileBuildStore, error) {
+	fs := &FileBuildStore{
+		path:   path,
+		limit:  limit,
+		nextId: 1,
+		byId:   make(map[int64]*Build),
+	}
+
+	err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (fs *FileBuildStore) Record(b *Build) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	b.Id = fs.nextId
+	stored := *b
+	fs.add(&stored)
+
+	return fs.write(&stored)
+}
+
+func (fs *FileBuildStore) Notify(n *JenkinsNotification, at time.Time) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	b := fs.find(n)
+	if b == nil {
+		b = &Build{
+			Id:         fs.nextId,
+			Job:        n.Name,
+			Repository: n.Repository(),
+			Branch:     n.Build.Parameters["BRANCH"],
+			Sha:        n.Sha(),
+			Pusher:     n.Build.Parameters["PUSHER"],
+			QueuedAt:   at,
+		}
+		fs.add(b)
+	}
+
+	b.Number = n.Build.Number
+	b.ConsoleUrl = n.ConsoleUrl()
+	if b.Sha == "" {
+		b.Sha = n.Sha()
+	}
+
+	status := n.CommitStatus()
+	if status != nil {
+		b.Status = status.State
+		switch n.Build.Phase {
+		case phaseStarted:
+			b.StartedAt = at
+		case phaseCompleted:
+			b.FinishedAt = at
+		}
+	}
+
+	return fs.write(b)
+}
+
+func (fs *FileBuildStore) List(f *BuildFilter) ([]Build, error) {
+	fs.RLock()
+	defer fs.RUnlock()
+
+	builds := make([]Build, 0, 32)
+	for i := len(fs.builds) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(builds) == f.Limit {
+			break
+		}
+		if f.Match(fs.builds[i]) {
+			builds = append(builds, *fs.builds[i])
+		}
+	}
+
+	return builds, nil
+}
+
+func (fs *FileBuildStore) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return fs.file.Close()
+}
+
+// find returns the newest build of the notified job and commit that has not
+// been claimed by a different Jenkins build number. Builds queued without a
+// commit, such as from Hubot, are matched by job when no commit matches.
+func (fs *FileBuildStore) find(n *JenkinsNotification) *Build {
+	sha := n.Sha()
+	var unknown *Build
+	for i := len(fs.builds) - 1; i >= 0; i-- {
+		b := fs.builds[i]
+		if b.Job != n.Name || (b.Number != 0 && b.Number != n.Build.Number) {
+			continue
+		}
+		if b.Sha == sha {
+			return b
+		}
+		if b.Sha == "" && b.Number == 0 && unknown == nil {
+			unknown = b
+		}
+	}
+	return unknown
+}
+
+func (fs *FileBuildStore) add(b *Build) {
+	if existing, ok := fs.byId[b.Id]; ok {
+		*existing = *b
+		return
+	}
+
+	fs.builds = append(fs.builds, b)
+	fs.byId[b.Id] = b
+	if b.Id >= fs.nextId {
+		fs.nextId = b.Id + 1
+	}
+
+	if len(fs.builds) > fs.limit {
+		delete(fs.byId, fs.builds[0].Id)
+		fs.builds = fs.builds[1:]
+	}
+}
+
+func (fs *FileBuildStore) write(b *Build) error {
+	line, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	fs.lines++
+	if fs.lines > 2*fs.limit {
+		return fs.compact()
+	}
+
+	return nil
+}
+
+func (fs *FileBuildStore) load() error {
+	f, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		b := &Build{}
+		if json.Unmarshal(scanner.Bytes(), b) != nil {
+			continue
+		}
+		fs.add(b)
+	}
+
+	sort.Slice(fs.builds, func(i, j int) bool { return fs.builds[i].Id < fs.builds[j].Id })
+	return scanner.Err()
+}
+
+// compact rewrites the log with a single entry per retained build.
+func (fs *FileBuildStore) compact() error {
+	err := rewriteLog(fs.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, b := range fs.builds {
+			err := enc.Encode(b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if fs.file != nil {
+		fs.file.Close()
+	}
+
+	fs.file, err = os.OpenFile(fs.path, os.O_APPEND|os.O_WRONLY, 0600)
+	fs.lines = len(fs.builds)
+	return err
+}
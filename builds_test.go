@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newNotification(t *testing.T, phase, status string) *JenkinsNotification {
+	n := &JenkinsNotification{}
+	err := json.Unmarshal([]byte(validNotification), n)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	n.Build.Phase = phase
+	n.Build.Status = status
+	return n
+}
+
+func openBuilds(t *testing.T, path string) *FileBuildStore {
+	fs, err := OpenFileBuildStore(path, 10)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	return fs
+}
+
+func Test_FileBuildStore_should_track_build_lifecycle(t *testing.T) {
+	fs := openBuilds(t, filepath.Join(t.TempDir(), buildFile))
+	defer fs.Close()
+
+	recordBuild(fs, &BuildRequest{
+		Job:        "releases-web-28084179",
+		Sha:        "ebe220cce16e1d9ff50b7bf0de5033ff89c4ed81",
+		Branch:     "master",
+		Repository: "hailocab/releases-web",
+		Pusher:     "nfisher",
+	}, "http://ci.local/queue/item/42/")
+
+	started := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	fs.Notify(newNotification(t, "STARTED", ""), started)
+	fs.Notify(newNotification(t, "COMPLETED", "SUCCESS"), started.Add(90*time.Second))
+
+	builds, _ := fs.List(&BuildFilter{})
+	if len(builds) != 1 {
+		t.Fatalf("len(builds) = %v, want 1", len(builds))
+	}
+
+	b := builds[0]
+	if b.Number != 18 || b.Status != "success" || b.Pusher != "nfisher" {
+		t.Fatalf("build = %+v, want #18 success by nfisher", b)
+	}
+
+	if b.Duration() != 90*time.Second {
+		t.Fatalf("b.Duration() = %v, want 1m30s", b.Duration())
+	}
+}
+
+func Test_FileBuildStore_should_claim_build_queued_without_sha(t *testing.T) {
+	fs := openBuilds(t, filepath.Join(t.TempDir(), buildFile))
+	defer fs.Close()
+
+	recordBuild(fs, &BuildRequest{
+		Job:        "releases-web-28084179",
+		Branch:     "master",
+		Repository: "hailocab/releases-web",
+		Pusher:     "hubot",
+	}, "http://ci.local/queue/item/43/")
+
+	now := time.Now()
+	fs.Notify(newNotification(t, "STARTED", ""), now)
+	fs.Notify(newNotification(t, "COMPLETED", "SUCCESS"), now.Add(time.Minute))
+
+	builds, _ := fs.List(&BuildFilter{})
+	if len(builds) != 1 {
+		t.Fatalf("builds = %+v, want the queued build only", builds)
+	}
+
+	b := builds[0]
+	if b.Number != 18 || b.Status != "success" || b.Pusher != "hubot" || b.Sha == "" {
+		t.Fatalf("build = %+v, want #18 success by hubot with the notified sha", b)
+	}
+}
+
+func Test_FileBuildStore_should_record_unknown_notification(t *testing.T) {
+	fs := openBuilds(t, filepath.Join(t.TempDir(), buildFile))
+	defer fs.Close()
+
+	fs.Notify(newNotification(t, "COMPLETED", "FAILURE"), time.Now())
+
+	builds, _ := fs.List(&BuildFilter{Repository: "hailocab/releases-web"})
+	if len(builds) != 1 || builds[0].Status != "failure" {
+		t.Fatalf("builds = %+v, want single failure", builds)
+	}
+}
+
+func Test_FileBuildStore_should_filter_newest_first(t *testing.T) {
+	fs := openBuilds(t, filepath.Join(t.TempDir(), buildFile))
+	defer fs.Close()
+
+	for _, branch := range []string{"master", "feature", "master"} {
+		fs.Record(&Build{Repository: "hailocab/releases-web", Branch: branch, Status: buildQueued})
+	}
+
+	builds, _ := fs.List(&BuildFilter{Branch: "master", Limit: 1})
+	if len(builds) != 1 || builds[0].Id != 3 {
+		t.Fatalf("builds = %+v, want build 3", builds)
+	}
+}
+
+func Test_FileBuildStore_should_survive_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), buildFile)
+
+	fs := openBuilds(t, path)
+	fs.Record(&Build{Job: "a-1", Sha: "abc", Status: buildQueued})
+	fs.Record(&Build{Job: "b-2", Sha: "def", Status: buildQueued})
+	fs.Close()
+
+	fs = openBuilds(t, path)
+	defer fs.Close()
+
+	err := fs.Record(&Build{Job: "c-3"})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	builds, _ := fs.List(&BuildFilter{})
+	if len(builds) != 3 || builds[0].Id != 3 || builds[2].Job != "a-1" {
+		t.Fatalf("builds = %+v, want 3 builds with ids 3..1", builds)
+	}
+}
+
+func Test_NewBuildStore_should_be_nil_without_database_url(t *testing.T) {
+	builds, err := NewBuildStore(&Config{})
+	if err != nil || builds != nil {
+		t.Fatalf("NewBuildStore() = %v, %v, want nil, nil", builds, err)
+	}
+}
@@ -2,19 +2,107 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+
+	"golang.org/x/oauth2"
 )
 
+// HookSecret is a webhook secret that is accepted until it expires.
+type HookSecret struct {
+	Name    string
+	Secret  string
+	Expires time.Time
+}
+
 type Github struct {
-	ClientId     string
-	ClientSecret string
-	Token        string
-	User         string
-	Password     string
-	HookSecret   string
-	ApiUrl       string
-	Organization string
+	ClientId          string
+	ClientSecret      string
+	Token             string
+	User              string
+	Password          string
+	HookSecret        string
+	HookSecrets       []HookSecret
+	ApiUrl            string
+	WebUrl            string
+	Organization      string
+	ReconcileInterval string
+	RefreshInterval   string
+	RefreshJitter     string
+	BuildMergeRef     bool
+	AllowSha1         bool
+	AppId             int64
+	InstallationId    int64
+	PrivateKeyPath    string
+}
+
+const (
+	githubApiUrl         = "https://api.github.com"
+	githubWebUrl         = "https://github.com"
+	githubEnterprisePath = "/api/v3"
+)
+
+// ApiBaseUrl is the REST API root without a trailing slash. Enterprise hosts
+// given without a path get the /api/v3 prefix.
+func (g *Github) ApiBaseUrl() string {
+	if g == nil || g.ApiUrl == "" {
+		return githubApiUrl
+	}
+
+	apiUrl := strings.TrimRight(g.ApiUrl, "/")
+	u, err := url.Parse(apiUrl)
+	if err == nil && u.Path == "" && u.Host != "api.github.com" {
+		apiUrl += githubEnterprisePath
+	}
+
+	return apiUrl
+}
+
+// WebBaseUrl is the root for links to repositories and commits, derived from
+// the API URL unless WebUrl is set.
+func (g *Github) WebBaseUrl() string {
+	if g != nil && g.WebUrl != "" {
+		return strings.TrimRight(g.WebUrl, "/")
+	}
+
+	apiUrl := g.ApiBaseUrl()
+	if apiUrl == githubApiUrl {
+		return githubWebUrl
+	}
+
+	return strings.TrimSuffix(apiUrl, githubEnterprisePath)
+}
+
+// OAuthEndpoint is the web application flow endpoint of the GitHub instance.
+func (g *Github) OAuthEndpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  g.WebBaseUrl() + "/login/oauth/authorize",
+		TokenURL: g.WebBaseUrl() + "/login/oauth/access_token",
+	}
+}
+
+// SignInEnabled reports whether the web UI requires signing in with GitHub.
+func (g *Github) SignInEnabled() bool {
+	return g != nil && g.ClientId != ""
+}
+
+// HasCredentials reports whether Lanky can call the GitHub API. A section
+// holding only the hook secret just verifies deliveries.
+func (g *Github) HasCredentials() bool {
+	return g != nil && (g.Token != "" || g.IsApp())
+}
+
+// IsApp reports whether Lanky authenticates as a GitHub App.
+func (g *Github) IsApp() bool {
+	return g.AppId != 0
 }
 
 type Hubot struct {
@@ -23,8 +111,68 @@ type Hubot struct {
 }
 
 type Jenkins struct {
-	BaseUrl  string
-	TrayFeed string
+	BaseUrl      string
+	TrayFeed     string
+	User         string
+	Token        string
+	NotifySecret string
+	JobTemplate  string
+}
+
+// Server tunes the HTTP listener, durations use time.ParseDuration syntax.
+type Server struct {
+	ReadTimeout     string
+	WriteTimeout    string
+	IdleTimeout     string
+	ShutdownDelay   string
+	ShutdownTimeout string
+	MaxHeaderBytes  int
+}
+
+type Admin struct {
+	User     string
+	Password string
+	Token    string
+	Address  string
+}
+
+// HasCredentials reports whether any admin authentication is configured.
+func (a *Admin) HasCredentials() bool {
+	return a != nil && (a.User != "" || a.Token != "")
+}
+
+// ActiveHookSecrets is HookSecret followed by the HookSecrets which have not
+// expired. The first entry is the current secret.
+func (g *Github) ActiveHookSecrets(now time.Time) (secrets []HookSecret) {
+	if g == nil {
+		return nil
+	}
+
+	if g.HookSecret != "" {
+		secrets = append(secrets, HookSecret{Name: "hookSecret", Secret: g.HookSecret})
+	}
+
+	for i, hs := range g.HookSecrets {
+		if hs.Secret == "" || (!hs.Expires.IsZero() && now.After(hs.Expires)) {
+			continue
+		}
+		if hs.Name == "" {
+			hs.Name = fmt.Sprintf("hookSecrets[%v]", i)
+		}
+		secrets = append(secrets, hs)
+	}
+
+	return secrets
+}
+
+// CurrentHookSecret is the secret installed on new or repaired webhooks.
+func (g *Github) CurrentHookSecret() string {
+	secrets := g.ActiveHookSecrets(time.Now())
+	if len(secrets) == 0 {
+		return ""
+	}
+
+	return secrets[0].Secret
 }
 
 // Lanky run-time configuration.
@@ -36,15 +184,86 @@ type Config struct {
 	ChatDefaultRoom string
 	DatabaseUrl     string
 	TemplatesDir    string
+	TemplatesReload bool
+	SessionSecret   string
+	Workers         int
+	QueueSize       int
 	Jenkins         *Jenkins
 	Hubot           *Hubot
 	Github          *Github
+	Admin           *Admin
+	Server          *Server
 }
 
 func (c *Config) ClientTimeout() time.Duration {
 	return time.Duration(5 * time.Second)
 }
 
+const (
+	defaultWorkers   = 4
+	defaultQueueSize = 100
+
+	defaultReadTimeout     = 10 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 120 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+	defaultMaxHeaderBytes  = 64 << 10
+)
+
+// WorkerCount is the number of webhook events processed concurrently.
+func (c *Config) WorkerCount() int {
+	if c.Workers < 1 {
+		return defaultWorkers
+	}
+	return c.Workers
+}
+
+// EventQueueSize is the number of webhook events buffered before deliveries are refused.
+func (c *Config) EventQueueSize() int {
+	if c.QueueSize < 1 {
+		return defaultQueueSize
+	}
+	return c.QueueSize
+}
+
+// serverDuration parses the named server setting, using def when it is not set.
+func (c *Config) serverDuration(setting func(*Server) string, def time.Duration) (time.Duration, error) {
+	if c.Server == nil || setting(c.Server) == "" {
+		return def, nil
+	}
+
+	return time.ParseDuration(setting(c.Server))
+}
+
+func (c *Config) ReadTimeout() (time.Duration, error) {
+	return c.serverDuration(func(s *Server) string { return s.ReadTimeout }, defaultReadTimeout)
+}
+
+func (c *Config) WriteTimeout() (time.Duration, error) {
+	return c.serverDuration(func(s *Server) string { return s.WriteTimeout }, defaultWriteTimeout)
+}
+
+func (c *Config) IdleTimeout() (time.Duration, error) {
+	return c.serverDuration(func(s *Server) string { return s.IdleTimeout }, defaultIdleTimeout)
+}
+
+// ShutdownDelay is how long readiness fails before the listener is closed.
+func (c *Config) ShutdownDelay() (time.Duration, error) {
+	return c.serverDuration(func(s *Server) string { return s.ShutdownDelay }, 0)
+}
+
+// ShutdownTimeout bounds the whole drain of requests and queued events.
+func (c *Config) ShutdownTimeout() (time.Duration, error) {
+	return c.serverDuration(func(s *Server) string { return s.ShutdownTimeout }, defaultShutdownTimeout)
+}
+
+func (c *Config) MaxHeaderBytes() int {
+	if c.Server == nil || c.Server.MaxHeaderBytes < 1 {
+		return defaultMaxHeaderBytes
+	}
+	return c.Server.MaxHeaderBytes
+}
+
 func (c *Config) TrayFeedUrl() string {
 	if c.Jenkins == nil {
 		return ""
@@ -53,9 +272,313 @@ func (c *Config) TrayFeedUrl() string {
 	return c.Jenkins.BaseUrl + c.Jenkins.TrayFeed
 }
 
+// BuilderUrl is the callback Jenkins notifies when a build changes state.
+func (c *Config) BuilderUrl() string {
+	return strings.TrimRight(c.BaseUrl, "/") + "/_builder"
+}
+
+// HookUrl is the GitHub webhook endpoint installed on each repository.
+func (c *Config) HookUrl() string {
+	return strings.TrimRight(c.BaseUrl, "/") + "/_github"
+}
+
+// ReconcileInterval is how often webhooks are reconciled, zero when disabled.
+func (c *Config) ReconcileInterval() (time.Duration, error) {
+	if c.Github == nil || c.Github.ReconcileInterval == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(c.Github.ReconcileInterval)
+}
+
+// RefreshInterval is how often the repository cache is reloaded from GitHub.
+func (c *Config) RefreshInterval() (time.Duration, error) {
+	if c.Github == nil || c.Github.RefreshInterval == "" {
+		return defaultRefreshInterval, nil
+	}
+
+	d, err := time.ParseDuration(c.Github.RefreshInterval)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("must be positive")
+	}
+
+	return d, nil
+}
+
+// RefreshJitter is the most added at random to each refresh interval.
+func (c *Config) RefreshJitter() (time.Duration, error) {
+	if c.Github == nil || c.Github.RefreshJitter == "" {
+		return defaultRefreshJitter, nil
+	}
+
+	d, err := time.ParseDuration(c.Github.RefreshJitter)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+
+	return d, nil
+}
+
+// NotifyUrl is the builder callback including the shared notification secret.
+func (c *Config) NotifyUrl() string {
+	if c.Jenkins == nil {
+		return c.BuilderUrl()
+	}
+
+	return c.BuilderUrl() + "?token=" + url.QueryEscape(c.Jenkins.NotifySecret)
+}
+
+// DatabasePath is the directory Lanky keeps its state in, taken from DatabaseUrl.
+func (c *Config) DatabasePath() (string, error) {
+	return parseDatabaseUrl(c.DatabaseUrl)
+}
+
+// parseDatabaseUrl accepts file:// URLs or plain paths.
+func parseDatabaseUrl(databaseUrl string) (string, error) {
+	u, err := url.Parse(databaseUrl)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "":
+		return databaseUrl, nil
+	case "file":
+		return u.Host + u.Path, nil
+	}
+
+	return "", fmt.Errorf("Unsupported database scheme %v.", u.Scheme)
+}
+
 func LoadConfig(r io.Reader, c *Config) error {
 	dec := json.NewDecoder(r)
 	err := dec.Decode(c)
 
 	return err
 }
+
+const envPrefix = "LANKY"
+
+// ApplyEnv overrides config fields from environment variables named after the
+// field path, e.g. LANKY_GITHUB_TOKEN or LANKY_JENKINS_BASE_URL. Missing
+// sections are created when one of their fields is set. Lists such as
+// LANKY_GITHUB_HOOK_SECRETS are given as JSON.
+func ApplyEnv(c *Config, lookup func(string) (string, bool)) error {
+	_, err := applyEnv(reflect.ValueOf(c).Elem(), envPrefix, lookup)
+	return err
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) (applied bool, err error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + "_" + envName(t.Field(i).Name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			section := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				section = field
+			}
+
+			ok, err := applyEnv(section.Elem(), name, lookup)
+			if err != nil {
+				return applied, err
+			}
+			if ok {
+				field.Set(section)
+				applied = true
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		err = setField(field, value)
+		if err != nil {
+			return applied, fmt.Errorf("Invalid %v: %v.", name, err)
+		}
+		applied = true
+	}
+
+	return applied, nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	default:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+
+	return nil
+}
+
+// envName converts a field name such as BaseUrl to BASE_URL.
+func envName(field string) string {
+	var b strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError []string
+
+func (ve ValidationError) Error() string {
+	return "Invalid configuration: " + strings.Join(ve, " ")
+}
+
+// Validate reports all configuration problems at once so they surface at
+// startup rather than on the first request.
+func (c *Config) Validate() error {
+	var problems ValidationError
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	checkUrl := func(name, value string) {
+		if value == "" {
+			return
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("%v %q is not an http(s) URL.", name, value)
+		}
+	}
+
+	checkUrl("baseUrl", c.BaseUrl)
+
+	if (c.CertificatePath == "") != (c.KeyPath == "") {
+		problem("certificatePath and keyPath must be set together.")
+	}
+
+	if _, err := c.DatabasePath(); err != nil {
+		problem("databaseUrl: %v", err)
+	}
+
+	if c.TemplatesDir != "" {
+		info, err := os.Stat(c.TemplatesDir)
+		if err != nil || !info.IsDir() {
+			problem("templatesDir %v is not a directory.", c.TemplatesDir)
+		}
+	}
+
+	for _, setting := range []struct {
+		name    string
+		timeout func() (time.Duration, error)
+	}{
+		{"server.readTimeout", c.ReadTimeout},
+		{"server.writeTimeout", c.WriteTimeout},
+		{"server.idleTimeout", c.IdleTimeout},
+		{"server.shutdownDelay", c.ShutdownDelay},
+		{"server.shutdownTimeout", c.ShutdownTimeout},
+	} {
+		if _, err := setting.timeout(); err != nil {
+			problem("%v: %v.", setting.name, err)
+		}
+	}
+
+	if c.Workers < 0 || c.QueueSize < 0 {
+		problem("workers and queueSize must not be negative.")
+	}
+
+	if c.Jenkins == nil {
+		problem("jenkins section is missing.")
+	} else {
+		if c.Jenkins.BaseUrl == "" {
+			problem("jenkins.baseUrl is required.")
+		}
+		checkUrl("jenkins.baseUrl", c.Jenkins.BaseUrl)
+		if c.Jenkins.TrayFeed == "" {
+			problem("jenkins.trayFeed is required.")
+		}
+		if c.Jenkins.Token != "" && c.Jenkins.User == "" {
+			problem("jenkins.token requires jenkins.user.")
+		}
+	}
+
+	if len(c.Github.ActiveHookSecrets(time.Now())) == 0 {
+		problem("github.hookSecret is required to verify /_github deliveries.")
+	}
+
+	if c.Github != nil {
+		checkUrl("github.apiUrl", c.Github.ApiUrl)
+		checkUrl("github.webUrl", c.Github.WebUrl)
+		if c.Github.IsApp() {
+			if _, err := readPrivateKey(c.Github.PrivateKeyPath); err != nil {
+				problem("github.privateKeyPath: %v", err)
+			}
+			if c.Github.InstallationId == 0 && c.Github.Organization == "" {
+				problem("github.organization or github.installationId is required for a GitHub App.")
+			}
+		}
+		if c.Github.SignInEnabled() {
+			if c.Github.ClientSecret == "" {
+				problem("github.clientSecret is required with github.clientId.")
+			}
+			if c.Github.Organization == "" {
+				problem("github.organization is required to restrict sign in.")
+			}
+			if c.BaseUrl == "" {
+				problem("baseUrl is required for the OAuth callback.")
+			}
+			if len(c.SessionSecret) < minSessionSecret {
+				problem("sessionSecret must be at least %v characters with github.clientId.", minSessionSecret)
+			}
+		}
+		if _, err := c.ReconcileInterval(); err != nil {
+			problem("github.reconcileInterval: %v.", err)
+		}
+		if _, err := c.RefreshInterval(); err != nil {
+			problem("github.refreshInterval: %v.", err)
+		}
+		if _, err := c.RefreshJitter(); err != nil {
+			problem("github.refreshJitter: %v.", err)
+		}
+	}
+
+	if c.Hubot != nil && (c.Hubot.User == "" || c.Hubot.Password == "") {
+		problem("hubot.user and hubot.password are both required.")
+	}
+
+	if c.Admin != nil && (c.Admin.User == "") != (c.Admin.Password == "") {
+		problem("admin.user and admin.password must be set together.")
+	}
+
+	if c.Admin != nil && c.Admin.Address != "" && c.Admin.Address == c.Address {
+		problem("admin.address must differ from address.")
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -105,3 +106,346 @@ func Test_ClientTimeout(t *testing.T) {
 		t.Fatalf("c.ClientTimeout() = %v, want %v", c.ClientTimeout(), expected)
 	}
 }
+
+func Test_HookUrl(t *testing.T) {
+	c := &Config{BaseUrl: "http://lanky.local:9393/"}
+
+	expected := "http://lanky.local:9393/_github"
+	if c.HookUrl() != expected {
+		t.Fatalf("c.HookUrl() = %v, want %v", c.HookUrl(), expected)
+	}
+}
+
+var reconcileIntervalTable = []struct {
+	github   *Github
+	expected time.Duration
+	err      bool
+}{
+	{nil, 0, false},
+	{&Github{}, 0, false},
+	{&Github{ReconcileInterval: "6h"}, 6 * time.Hour, false},
+	{&Github{ReconcileInterval: "often"}, 0, true},
+}
+
+func Test_ReconcileInterval(t *testing.T) {
+	for _, tt := range reconcileIntervalTable {
+		c := &Config{Github: tt.github}
+
+		actual, err := c.ReconcileInterval()
+		if (err != nil) != tt.err {
+			t.Fatalf("err = %v, want error %v", err, tt.err)
+		}
+
+		if actual != tt.expected {
+			t.Fatalf("c.ReconcileInterval() = %v, want %v", actual, tt.expected)
+		}
+	}
+}
+
+func Test_ActiveHookSecrets_should_skip_expired_and_empty_secrets(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	g := &Github{
+		HookSecret: "current",
+		HookSecrets: []HookSecret{
+			{Name: "previous", Secret: "previous", Expires: now.Add(time.Hour)},
+			{Secret: "forever"},
+			{Name: "expired", Secret: "expired", Expires: now.Add(-time.Hour)},
+			{Name: "empty"},
+		},
+	}
+
+	secrets := g.ActiveHookSecrets(now)
+
+	expected := []string{"hookSecret", "previous", "hookSecrets[1]"}
+	if len(secrets) != len(expected) {
+		t.Fatalf("len(secrets) = %v, want %v", len(secrets), len(expected))
+	}
+
+	for i := range expected {
+		if secrets[i].Name != expected[i] {
+			t.Fatalf("secrets[%v].Name = %v, want %v", i, secrets[i].Name, expected[i])
+		}
+	}
+}
+
+func Test_CurrentHookSecret_should_use_first_active_secret(t *testing.T) {
+	g := &Github{
+		HookSecrets: []HookSecret{
+			{Secret: "next"},
+			{Secret: "previous"},
+		},
+	}
+
+	if g.CurrentHookSecret() != "next" {
+		t.Fatalf("g.CurrentHookSecret() = %v, want next", g.CurrentHookSecret())
+	}
+
+	g = &Github{}
+	if g.CurrentHookSecret() != "" {
+		t.Fatalf("g.CurrentHookSecret() = %v, want \"\"", g.CurrentHookSecret())
+	}
+}
+
+var databasePathTable = []struct {
+	databaseUrl string
+	expected    string
+	err         bool
+}{
+	{"", "", false},
+	{"/var/lib/lanky", "/var/lib/lanky", false},
+	{"file:///var/lib/lanky", "/var/lib/lanky", false},
+	{"postgres://db.local/lanky", "", true},
+}
+
+func Test_DatabasePath(t *testing.T) {
+	for _, tt := range databasePathTable {
+		c := &Config{DatabaseUrl: tt.databaseUrl}
+
+		actual, err := c.DatabasePath()
+		if (err != nil) != tt.err {
+			t.Fatalf("err = %v, want error %v", err, tt.err)
+		}
+
+		if actual != tt.expected {
+			t.Fatalf("c.DatabasePath() = %v, want %v", actual, tt.expected)
+		}
+	}
+}
+
+func Test_WorkerCount_and_EventQueueSize_defaults(t *testing.T) {
+	c := &Config{}
+
+	if c.WorkerCount() != defaultWorkers {
+		t.Fatalf("c.WorkerCount() = %v, want %v", c.WorkerCount(), defaultWorkers)
+	}
+
+	if c.EventQueueSize() != defaultQueueSize {
+		t.Fatalf("c.EventQueueSize() = %v, want %v", c.EventQueueSize(), defaultQueueSize)
+	}
+
+	c = &Config{Workers: 2, QueueSize: 10}
+	if c.WorkerCount() != 2 || c.EventQueueSize() != 10 {
+		t.Fatalf("c.WorkerCount(), c.EventQueueSize() = %v, %v, want 2, 10", c.WorkerCount(), c.EventQueueSize())
+	}
+}
+
+var envNameTable = []struct {
+	field    string
+	expected string
+}{
+	{"Token", "TOKEN"},
+	{"BaseUrl", "BASE_URL"},
+	{"ClientId", "CLIENT_ID"},
+	{"HookSecrets", "HOOK_SECRETS"},
+	{"AllowSha1", "ALLOW_SHA1"},
+}
+
+func Test_envName(t *testing.T) {
+	for _, tt := range envNameTable {
+		actual := envName(tt.field)
+		if actual != tt.expected {
+			t.Fatalf("envName(%v) = %v, want %v", tt.field, actual, tt.expected)
+		}
+	}
+}
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func Test_ApplyEnv_should_override_and_create_sections(t *testing.T) {
+	c := &Config{Address: ":9393", Jenkins: &Jenkins{BaseUrl: "http://jenkins.local", TrayFeed: "/cc.xml"}}
+
+	err := ApplyEnv(c, envLookup(map[string]string{
+		"LANKY_ADDRESS":             ":8080",
+		"LANKY_WORKERS":             "8",
+		"LANKY_JENKINS_BASE_URL":    "http://ci.local",
+		"LANKY_GITHUB_TOKEN":        "abc123",
+		"LANKY_GITHUB_ALLOW_SHA1":   "true",
+		"LANKY_GITHUB_HOOK_SECRETS": `[{"name":"old","secret":"s3cret"}]`,
+	}))
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if c.Address != ":8080" || c.Workers != 8 {
+		t.Fatalf("c.Address, c.Workers = %v, %v, want :8080, 8", c.Address, c.Workers)
+	}
+
+	if c.Jenkins.BaseUrl != "http://ci.local" || c.Jenkins.TrayFeed != "/cc.xml" {
+		t.Fatalf("c.Jenkins = %+v, want overridden BaseUrl and kept TrayFeed", c.Jenkins)
+	}
+
+	if c.Github == nil || c.Github.Token != "abc123" || !c.Github.AllowSha1 {
+		t.Fatalf("c.Github = %+v, want Token abc123 and AllowSha1", c.Github)
+	}
+
+	if len(c.Github.HookSecrets) != 1 || c.Github.HookSecrets[0].Secret != "s3cret" {
+		t.Fatalf("c.Github.HookSecrets = %v, want one s3cret entry", c.Github.HookSecrets)
+	}
+
+	if c.Hubot != nil {
+		t.Fatalf("c.Hubot = %v, want nil", c.Hubot)
+	}
+}
+
+func Test_ApplyEnv_should_reject_invalid_value(t *testing.T) {
+	err := ApplyEnv(&Config{}, envLookup(map[string]string{"LANKY_WORKERS": "many"}))
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+
+	if !strings.Contains(err.Error(), "LANKY_WORKERS") {
+		t.Fatalf("err.Error() = %v, want to contain %v", err.Error(), "LANKY_WORKERS")
+	}
+}
+
+func Test_Validate_should_accept_valid_config(t *testing.T) {
+	c := &Config{
+		BaseUrl: "http://lanky.local:9393/",
+		Jenkins: &Jenkins{BaseUrl: "http://jenkins.local:8080", TrayFeed: "/cc.xml"},
+		Github:  &Github{Token: "abc123", HookSecret: "abc123"},
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func Test_Validate_should_report_all_problems(t *testing.T) {
+	c := &Config{
+		BaseUrl:         "lanky.local",
+		CertificatePath: "lanky.crt",
+		DatabaseUrl:     "postgres://db.local/lanky",
+		Jenkins:         &Jenkins{BaseUrl: "http://jenkins.local:8080"},
+		Github:          &Github{Token: "abc123", ReconcileInterval: "daily"},
+		Hubot:           &Hubot{User: "hubot"},
+	}
+
+	err := c.Validate()
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("err = %v, want ValidationError", err)
+	}
+
+	if len(problems) != 7 {
+		t.Fatalf("len(problems) = %v, want %v: %v", len(problems), 7, problems)
+	}
+}
+
+func Test_Validate_should_require_hook_secret_without_github_section(t *testing.T) {
+	c := &Config{
+		Jenkins: &Jenkins{BaseUrl: "http://jenkins.local:8080", TrayFeed: "/cc.xml"},
+	}
+
+	err := c.Validate()
+	problems, ok := err.(ValidationError)
+	if !ok || len(problems) != 1 || !strings.Contains(problems[0], "github.hookSecret") {
+		t.Fatalf("err = %v, want github.hookSecret problem", err)
+	}
+}
+
+func Test_Validate_should_accept_sample_config(t *testing.T) {
+	f, err := os.Open("lanky.json")
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	defer f.Close()
+
+	c := &Config{}
+	err = LoadConfig(f, c)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+var githubCredentialsTable = []struct {
+	github   *Github
+	expected bool
+}{
+	{nil, false},
+	{&Github{HookSecret: "abc123"}, false},
+	{&Github{Token: "abc123"}, true},
+	{&Github{AppId: 42}, true},
+}
+
+func Test_Github_HasCredentials(t *testing.T) {
+	for _, tt := range githubCredentialsTable {
+		actual := tt.github.HasCredentials()
+		if actual != tt.expected {
+			t.Fatalf("HasCredentials(%+v) = %v, want %v", tt.github, actual, tt.expected)
+		}
+	}
+}
+
+func Test_Validate_should_require_sign_in_settings(t *testing.T) {
+	c := &Config{
+		Jenkins: &Jenkins{BaseUrl: "http://jenkins.local:8080", TrayFeed: "/cc.xml"},
+		Github:  &Github{Token: "abc123", HookSecret: "abc123", ClientId: "client"},
+	}
+
+	err := c.Validate()
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("err = %v, want ValidationError", err)
+	}
+
+	if len(problems) != 4 {
+		t.Fatalf("len(problems) = %v, want %v: %v", len(problems), 4, problems)
+	}
+}
+
+func Test_Validate_should_reject_invalid_refresh_settings(t *testing.T) {
+	c := &Config{
+		Jenkins: &Jenkins{BaseUrl: "http://jenkins.local:8080", TrayFeed: "/cc.xml"},
+		Github:  &Github{Token: "abc123", HookSecret: "abc123", RefreshInterval: "0s", RefreshJitter: "-1m"},
+	}
+
+	err := c.Validate()
+	problems, ok := err.(ValidationError)
+	if !ok || len(problems) != 2 {
+		t.Fatalf("err = %v, want 2 problems", err)
+	}
+}
+
+var githubUrlsTable = []struct {
+	github *Github
+	api    string
+	web    string
+}{
+	{nil, "https://api.github.com", "https://github.com"},
+	{&Github{ApiUrl: "https://api.github.com/"}, "https://api.github.com", "https://github.com"},
+	{&Github{ApiUrl: "https://ghe.example.com"}, "https://ghe.example.com/api/v3", "https://ghe.example.com"},
+	{&Github{ApiUrl: "https://ghe.example.com/api/v3/"}, "https://ghe.example.com/api/v3", "https://ghe.example.com"},
+	{&Github{ApiUrl: "https://ghe-api.example.com/api/v3", WebUrl: "https://ghe.example.com/"}, "https://ghe-api.example.com/api/v3", "https://ghe.example.com"},
+}
+
+func Test_Github_ApiBaseUrl_and_WebBaseUrl(t *testing.T) {
+	for _, tt := range githubUrlsTable {
+		if actual := tt.github.ApiBaseUrl(); actual != tt.api {
+			t.Fatalf("ApiBaseUrl() for %+v = %v, want %v", tt.github, actual, tt.api)
+		}
+
+		if actual := tt.github.WebBaseUrl(); actual != tt.web {
+			t.Fatalf("WebBaseUrl() for %+v = %v, want %v", tt.github, actual, tt.web)
+		}
+	}
+}
+
+func Test_Github_OAuthEndpoint_should_use_web_url(t *testing.T) {
+	g := &Github{ApiUrl: "https://ghe.example.com/api/v3"}
+
+	expected := "https://ghe.example.com/login/oauth/authorize"
+	if actual := g.OAuthEndpoint().AuthURL; actual != expected {
+		t.Fatalf("g.OAuthEndpoint().AuthURL = %v, want %v", actual, expected)
+	}
+}
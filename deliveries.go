@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deliveryLimit = 10000
+	deliveryTTL   = 72 * time.Hour
+	deliveryFile  = "deliveries.log"
+)
+
+// DeliveryStore remembers the X-GitHub-Delivery GUIDs that have been processed.
+type DeliveryStore interface {
+	// Seen reports whether the delivery has already been recorded.
+	Seen(id string, now time.Time) (bool, error)
+	// Record marks the delivery as processed.
+	Record(id string, now time.Time) error
+}
+
+// NewDeliveryStore returns a file-backed store when DatabaseUrl is set and
+// an in-memory store otherwise.
+func NewDeliveryStore(config *Config) (DeliveryStore, error) {
+	if config.DatabaseUrl == "" {
+		return NewMemoryDeliveryStore(deliveryLimit, deliveryTTL), nil
+	}
+
+	dir, err := config.DatabasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenFileDeliveryStore(filepath.Join(dir, deliveryFile), deliveryLimit, deliveryTTL)
+}
+
+type delivery struct {
+	id       string
+	recorded time.Time
+}
+
+// MemoryDeliveryStore holds at most limit deliveries for ttl, evicting the oldest first.
+type MemoryDeliveryStore struct {
+	sync.Mutex
+	limit int
+	ttl   time.Duration
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+func NewMemoryDeliveryStore(limit int, ttl time.Duration) *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{
+		limit: limit,
+		ttl:   ttl,
+		order: list.New(),
+		ids:   make(map[string]*list.Element),
+	}
+}
+
+func (ms *MemoryDeliveryStore) Seen(id string, now time.Time) (bool, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.expire(now)
+	_, ok := ms.ids[id]
+	return ok, nil
+}
+
+func (ms *MemoryDeliveryStore) Record(id string, now time.Time) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.add(id, now)
+	ms.expire(now)
+	return nil
+}
+
+func (ms *MemoryDeliveryStore) Len() int {
+	ms.Lock()
+	defer ms.Unlock()
+
+	return ms.order.Len()
+}
+
+func (ms *MemoryDeliveryStore) add(id string, recorded time.Time) {
+	if _, ok := ms.ids[id]; ok {
+		return
+	}
+
+	ms.ids[id] = ms.order.PushBack(&delivery{id, recorded})
+	for ms.order.Len() > ms.limit {
+		ms.remove(ms.order.Front())
+	}
+}
+
+func (ms *MemoryDeliveryStore) expire(now time.Time) {
+	for e := ms.order.Front(); e != nil; e = ms.order.Front() {
+		if now.Sub(e.Value.(*delivery).recorded) < ms.ttl {
+			return
+		}
+		ms.remove(e)
+	}
+}
+
+func (ms *MemoryDeliveryStore) remove(e *list.Element) {
+	delete(ms.ids, e.Value.(*delivery).id)
+	ms.order.Remove(e)
+}
+
+// FileDeliveryStore is a MemoryDeliveryStore that appends every delivery to a
+// log file so duplicates are still detected after a restart.
+type FileDeliveryStore struct {
+	*MemoryDeliveryStore
+	path string
+	file *os.File
+	// lines written to the log since it was last compacted.
+	lines int
+}
+
+func OpenFileDeliveryStore(path string, limit int, ttl time.Duration) (*FileDeliveryStore, error) {
+	fs := &FileDeliveryStore{
+		MemoryDeliveryStore: NewMemoryDeliveryStore(limit, ttl),
+		path:                path,
+	}
+
+	err := fs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	err = fs.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (fs *FileDeliveryStore) Record(id string, now time.Time) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if _, ok := fs.ids[id]; ok {
+		return nil
+	}
+
+	fs.add(id, now)
+	fs.expire(now)
+
+	_, err := fmt.Fprintf(fs.file, "%v\t%v\n", id, now.Unix())
+	if err != nil {
+		return err
+	}
+
+	fs.lines++
+	if fs.lines > 2*fs.limit {
+		return fs.compact()
+	}
+
+	return nil
+}
+
+func (fs *FileDeliveryStore) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	return fs.file.Close()
+}
+
+func (fs *FileDeliveryStore) load() error {
+	f, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 {
+			continue
+		}
+
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		fs.add(fields[0], time.Unix(sec, 0))
+	}
+
+	fs.expire(time.Now())
+	return scanner.Err()
+}
+
+// compact rewrites the log with only the retained deliveries. The caller must hold the lock.
+func (fs *FileDeliveryStore) compact() error {
+	err := rewriteLog(fs.path, func(w io.Writer) error {
+		for e := fs.order.Front(); e != nil; e = e.Next() {
+			d := e.Value.(*delivery)
+			_, err := fmt.Fprintf(w, "%v\t%v\n", d.id, d.recorded.Unix())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if fs.file != nil {
+		fs.file.Close()
+	}
+
+	fs.file, err = os.OpenFile(fs.path, os.O_APPEND|os.O_WRONLY, 0600)
+	fs.lines = fs.order.Len()
+	return err
+}
+
+// rewriteLog replaces the log at path with the content from write via a
+// temporary file, so a failure leaves the previous log intact.
+func rewriteLog(path string, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
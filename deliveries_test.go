@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDeliveries() DeliveryStore {
+	return NewMemoryDeliveryStore(deliveryLimit, deliveryTTL)
+}
+
+var epoch = time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+func Test_MemoryDeliveryStore_should_detect_recorded_delivery(t *testing.T) {
+	ms := NewMemoryDeliveryStore(10, time.Hour)
+
+	seen, _ := ms.Seen("72d3162e-cc78-11e3-81ab-4c9367dc0958", epoch)
+	if seen {
+		t.Fatal("seen = true, want false")
+	}
+
+	ms.Record("72d3162e-cc78-11e3-81ab-4c9367dc0958", epoch)
+
+	seen, _ = ms.Seen("72d3162e-cc78-11e3-81ab-4c9367dc0958", epoch.Add(time.Minute))
+	if !seen {
+		t.Fatal("seen = false, want true")
+	}
+}
+
+func Test_MemoryDeliveryStore_should_expire_deliveries(t *testing.T) {
+	ms := NewMemoryDeliveryStore(10, time.Hour)
+
+	ms.Record("a", epoch)
+	ms.Record("b", epoch.Add(30*time.Minute))
+
+	seen, _ := ms.Seen("a", epoch.Add(time.Hour))
+	if seen {
+		t.Fatal("seen = true, want false")
+	}
+
+	if ms.Len() != 1 {
+		t.Fatalf("ms.Len() = %v, want 1", ms.Len())
+	}
+}
+
+func Test_MemoryDeliveryStore_should_evict_oldest_when_full(t *testing.T) {
+	ms := NewMemoryDeliveryStore(2, time.Hour)
+
+	ms.Record("a", epoch)
+	ms.Record("b", epoch)
+	ms.Record("c", epoch)
+
+	seen, _ := ms.Seen("a", epoch)
+	if seen {
+		t.Fatal("seen = true, want false")
+	}
+
+	if ms.Len() != 2 {
+		t.Fatalf("ms.Len() = %v, want 2", ms.Len())
+	}
+}
+
+func Test_FileDeliveryStore_should_survive_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), deliveryFile)
+
+	fs, err := OpenFileDeliveryStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	err = fs.Record("a", time.Now())
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	fs.Close()
+
+	fs, err = OpenFileDeliveryStore(path, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	defer fs.Close()
+
+	seen, _ := fs.Seen("a", time.Now())
+	if !seen {
+		t.Fatal("seen = false, want true")
+	}
+}
+
+func Test_FileDeliveryStore_should_compact_log(t *testing.T) {
+	path := filepath.Join(t.TempDir(), deliveryFile)
+
+	fs, err := OpenFileDeliveryStore(path, 2, time.Hour)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	defer fs.Close()
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		fs.Record(id, time.Now())
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.Count(string(b), "\n")
+	if lines != 2 {
+		t.Fatalf("lines = %v, want 2", lines)
+	}
+}
+
+func Test_rewriteLog_should_keep_previous_log_on_failure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deliveries.log")
+	ioutil.WriteFile(path, []byte("previous\n"), 0600)
+
+	err := rewriteLog(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("disk full")
+	})
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if string(b) != "previous\n" {
+		t.Fatalf("log = %q, want %q", b, "previous\n")
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("os.Stat(tmp) err = %v, want not exist", err)
+	}
+}
+
+func Test_NewDeliveryStore_should_default_to_memory(t *testing.T) {
+	ds, err := NewDeliveryStore(&Config{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if _, ok := ds.(*MemoryDeliveryStore); !ok {
+		t.Fatalf("NewDeliveryStore() = %T, want *MemoryDeliveryStore", ds)
+	}
+}
+
+func Test_NewDeliveryStore_should_use_file_with_database_url(t *testing.T) {
+	ds, err := NewDeliveryStore(&Config{DatabaseUrl: "file://" + t.TempDir()})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	defer ds.(*FileDeliveryStore).Close()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var (
+	ErrDuplicateDelivery = errors.New("duplicate")
+	ErrQueueFull         = errors.New("Event queue is full.")
+	ErrQueueClosed       = errors.New("Event queue is closed.")
+)
+
+// Event is a verified GitHub webhook delivery awaiting processing.
+type Event struct {
+	Type     string
+	Delivery string
+	Body     []byte
+}
+
+// EventProcessor performs the work for an event and describes the outcome.
+type EventProcessor func(e *Event) (result string, err error)
+
+// EventQueue processes events on a fixed pool of workers. Deliveries are
+// recorded once processed successfully so failures can be redelivered.
+type EventQueue struct {
+	sync.Mutex
+	events     chan *Event
+	inflight   map[string]bool
+	closed     bool
+	wg         sync.WaitGroup
+	deliveries DeliveryStore
+	stats      *RuntimeStats
+	process    EventProcessor
+}
+
+func NewEventQueue(size, workers int, deliveries DeliveryStore, stats *RuntimeStats, process EventProcessor) *EventQueue {
+	q := &EventQueue{
+		events:     make(chan *Event, size),
+		inflight:   make(map[string]bool),
+		deliveries: deliveries,
+		stats:      stats,
+		process:    process,
+	}
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// Enqueue adds the event to the queue without blocking.
+func (q *EventQueue) Enqueue(e *Event) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if e.Delivery != "" {
+		if q.inflight[e.Delivery] {
+			return ErrDuplicateDelivery
+		}
+
+		seen, err := q.deliveries.Seen(e.Delivery, time.Now())
+		if err != nil {
+			return err
+		}
+		if seen {
+			return ErrDuplicateDelivery
+		}
+
+		q.inflight[e.Delivery] = true
+	}
+
+	select {
+	case q.events <- e:
+		q.stats.AddQueueDepth(1)
+		return nil
+	default:
+		delete(q.inflight, e.Delivery)
+		return ErrQueueFull
+	}
+}
+
+// Len is the number of events waiting for a worker.
+func (q *EventQueue) Len() int {
+	return len(q.events)
+}
+
+// Drain stops accepting events and waits up to timeout for the queued events to be processed.
+func (q *EventQueue) Drain(timeout time.Duration) error {
+	q.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out after %v with %v events queued.", timeout, q.Len())
+	}
+}
+
+func (q *EventQueue) work() {
+	defer q.wg.Done()
+
+	for e := range q.events {
+		q.stats.AddQueueDepth(-1)
+
+		result, err := q.process(e)
+		if err != nil {
+			q.stats.IncEvent(eventFailed)
+			metrics.IncEvent(e.Type, eventFailed)
+			glog.Errorf("GitHub %v delivery %v failed: %v", e.Type, e.Delivery, err)
+		} else {
+			q.stats.IncEvent(eventProcessed)
+			metrics.IncEvent(e.Type, eventProcessed)
+			glog.Infof("GitHub %v delivery %v: %v", e.Type, e.Delivery, result)
+			if e.Delivery != "" {
+				err = q.deliveries.Record(e.Delivery, time.Now())
+				if err != nil {
+					glog.Errorf("Unable to record delivery %v: %v", e.Delivery, err)
+				}
+			}
+		}
+
+		q.Lock()
+		delete(q.inflight, e.Delivery)
+		q.Unlock()
+	}
+}
+
+// ProcessEvent performs the Jenkins work for a push or pull request event.
+func ProcessEvent(config *Config, builds BuildStore, e *Event) (result string, err error) {
+	switch e.Type {
+	case "push":
+		return processPush(config, builds, e.Body)
+	case "pull_request":
+		return processPullRequest(config, builds, e.Body)
+	}
+
+	return "", fmt.Errorf("Unsupported event type %v.", e.Type)
+}
+
+func processPush(config *Config, builds BuildStore, body []byte) (result string, err error) {
+	push := &GithubPushPayload{}
+	err = json.Unmarshal(body, push)
+	if err != nil {
+		return "", err
+	}
+
+	if push.Deleted {
+		return "Ignored: branch deleted.", nil
+	}
+
+	j := NewJenkins(config)
+	if j == nil {
+		return "", errors.New("Jenkins configuration is invalid.")
+	}
+
+	build := &BuildRequest{
+		Job:        push.Repository.JobName(),
+		Sha:        push.After,
+		Branch:     push.Branch(),
+		Repository: push.Repository.FullName,
+		Pusher:     push.Pusher.Name,
+	}
+
+	return queueBuild(j, builds, build)
+}
+
+func processPullRequest(config *Config, builds BuildStore, body []byte) (result string, err error) {
+	pr := &GithubPullRequestPayload{}
+	err = json.Unmarshal(body, pr)
+	if err != nil {
+		return "", err
+	}
+
+	j := NewJenkins(config)
+	if j == nil {
+		return "", errors.New("Jenkins configuration is invalid.")
+	}
+
+	switch pr.Action {
+	case "opened", "synchronize", "reopened":
+		build := &BuildRequest{
+			Job:         pr.Repository.JobName(),
+			Sha:         pr.PullRequest.Head.Sha,
+			Branch:      pr.HeadRef(),
+			Repository:  pr.Repository.FullName,
+			Pusher:      pr.Sender.Login,
+			PullRequest: pr.Number,
+			BaseBranch:  pr.PullRequest.Base.Ref,
+		}
+		if config.Github != nil && config.Github.BuildMergeRef {
+			build.Branch = pr.MergeRef()
+		}
+
+		return queueBuild(j, builds, build)
+
+	case "closed":
+		cancelled, err := j.CancelQueued(pr.Repository.JobName(), pr.Number)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Cancelled %v queued builds.", cancelled), nil
+	}
+
+	return fmt.Sprintf("Ignored: %v action.", pr.Action), nil
+}
+
+func queueBuild(j *JenkinsClient, builds BuildStore, build *BuildRequest) (result string, err error) {
+	location, err := j.TriggerBuild(build)
+	if err != nil {
+		return "", err
+	}
+	recordBuild(builds, build, location)
+
+	return fmt.Sprintf("Queued %v at %v", build.Job, location), nil
+}
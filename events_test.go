@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newEvents returns a queue without workers so accepted events remain queued.
+func newEvents() *EventQueue {
+	return NewEventQueue(10, 0, newDeliveries(), NewStats(), nil)
+}
+
+func Test_EventQueue_should_process_and_record_deliveries(t *testing.T) {
+	deliveries := newDeliveries()
+	stats := NewStats()
+
+	var mu sync.Mutex
+	processed := make([]string, 0, 2)
+	q := NewEventQueue(10, 2, deliveries, stats, func(e *Event) (string, error) {
+		mu.Lock()
+		processed = append(processed, e.Delivery)
+		mu.Unlock()
+		if e.Delivery == "b" {
+			return "", errors.New("Jenkins is down")
+		}
+		return "OK", nil
+	})
+
+	for _, id := range []string{"a", "b"} {
+		err := q.Enqueue(&Event{Type: "push", Delivery: id})
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+	}
+
+	err := q.Drain(time.Second)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if len(processed) != 2 {
+		t.Fatalf("len(processed) = %v, want 2", len(processed))
+	}
+
+	seen, _ := deliveries.Seen("a", time.Now())
+	if !seen {
+		t.Fatal("deliveries.Seen(a) = false, want true")
+	}
+
+	seen, _ = deliveries.Seen("b", time.Now())
+	if seen {
+		t.Fatal("deliveries.Seen(b) = true, want false")
+	}
+
+	if stats.EventsProcessed() != 1 || stats.EventsFailed() != 1 || stats.QueueDepth() != 0 {
+		t.Fatalf("processed, failed, queued = %v, %v, %v, want 1, 1, 0", stats.EventsProcessed(), stats.EventsFailed(), stats.QueueDepth())
+	}
+}
+
+func Test_EventQueue_should_reject_inflight_and_seen_deliveries(t *testing.T) {
+	deliveries := newDeliveries()
+	deliveries.Record("seen", time.Now())
+	q := NewEventQueue(10, 0, deliveries, NewStats(), nil)
+
+	q.Enqueue(&Event{Type: "push", Delivery: "queued"})
+
+	for _, id := range []string{"queued", "seen"} {
+		err := q.Enqueue(&Event{Type: "push", Delivery: id})
+		if err != ErrDuplicateDelivery {
+			t.Fatalf("q.Enqueue(%v) = %v, want %v", id, err, ErrDuplicateDelivery)
+		}
+	}
+}
+
+func Test_EventQueue_should_reject_events_after_drain(t *testing.T) {
+	q := NewEventQueue(10, 1, newDeliveries(), NewStats(), nil)
+
+	q.Drain(time.Second)
+
+	err := q.Enqueue(&Event{Type: "push"})
+	if err != ErrQueueClosed {
+		t.Fatalf("err = %v, want %v", err, ErrQueueClosed)
+	}
+}
+
+func Test_EventQueue_Drain_should_time_out(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	q := NewEventQueue(10, 1, newDeliveries(), NewStats(), func(e *Event) (string, error) {
+		<-block
+		return "OK", nil
+	})
+	q.Enqueue(&Event{Type: "push"})
+
+	err := q.Drain(10 * time.Millisecond)
+	if err == nil {
+		t.Fatal("err = nil, want error")
+	}
+}
+
+func Test_ProcessEvent_should_fail_push_without_jenkins_config(t *testing.T) {
+	_, err := ProcessEvent(&Config{}, nil, &Event{Type: "push", Body: []byte(validPushResponse)})
+
+	expected := "Jenkins configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+func Test_ProcessEvent_should_queue_build_with_valid_push(t *testing.T) {
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "http://ci.local/queue/item/42/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer jenkins.Close()
+
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: jenkins.URL, TrayFeed: "/cc.xml"},
+	}
+
+	result, err := ProcessEvent(config, nil, &Event{Type: "push", Body: []byte(validPushResponse)})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expected := "Queued releases-web-28084179 at http://ci.local/queue/item/42/"
+	if result != expected {
+		t.Fatalf("result = %v, want %v", result, expected)
+	}
+}
+
+func Test_ProcessEvent_should_return_job_not_found(t *testing.T) {
+	jenkins := httptest.NewServer(http.NotFoundHandler())
+	defer jenkins.Close()
+
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: jenkins.URL, TrayFeed: "/cc.xml"},
+	}
+
+	_, err := ProcessEvent(config, nil, &Event{Type: "push", Body: []byte(validPushResponse)})
+	if _, ok := err.(*JobNotFoundError); !ok {
+		t.Fatalf("err = %#v, want *JobNotFoundError", err)
+	}
+}
+
+func Test_ProcessEvent_should_queue_merge_build_for_opened_pull_request(t *testing.T) {
+	var branch string
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		branch = r.Form.Get("BRANCH")
+		w.Header().Set("Location", "http://ci.local/queue/item/43/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer jenkins.Close()
+
+	config := &Config{
+		Github:  &Github{BuildMergeRef: true},
+		Jenkins: &Jenkins{BaseUrl: jenkins.URL, TrayFeed: "/cc.xml"},
+	}
+
+	_, err := ProcessEvent(config, nil, &Event{Type: "pull_request", Body: []byte(validPullRequestResponse)})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if branch != "pull/1/merge" {
+		t.Fatalf("BRANCH = %v, want pull/1/merge", branch)
+	}
+}
+
+func Test_ProcessEvent_should_cancel_queued_builds_for_closed_pull_request(t *testing.T) {
+	var cancelled []string
+	jenkins := newQueueServer(&cancelled)
+	defer jenkins.Close()
+
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: jenkins.URL, TrayFeed: "/cc.xml"},
+	}
+	body := strings.Replace(validPullRequestResponse, `"opened"`, `"closed"`, 1)
+
+	result, err := ProcessEvent(config, nil, &Event{Type: "pull_request", Body: []byte(body)})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expected := "Cancelled 1 queued builds."
+	if result != expected {
+		t.Fatalf("result = %v, want %v", result, expected)
+	}
+}
+
+func Test_ProcessEvent_should_ignore_labeled_pull_request(t *testing.T) {
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: "http://ci.local", TrayFeed: "/cc.xml"},
+	}
+	body := strings.Replace(validPullRequestResponse, `"opened"`, `"labeled"`, 1)
+
+	result, err := ProcessEvent(config, nil, &Event{Type: "pull_request", Body: []byte(body)})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expected := "Ignored: labeled action."
+	if result != expected {
+		t.Fatalf("result = %v, want %v", result, expected)
+	}
+}
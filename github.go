@@ -1,14 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/github"
 )
 
 type Url string
@@ -138,6 +140,11 @@ type Repository struct {
 	Organization     string
 }
 
+// JobName is the Jenkins project name for the repository.
+func (r *Repository) JobName() string {
+	return fmt.Sprintf("%v-%v", r.Name, r.Id)
+}
+
 type Repositories []Repository
 
 func (r Repositories) Len() int      { return len(r) }
@@ -145,6 +152,51 @@ func (r Repositories) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
 
 type ByFullName struct{ Repositories }
 
+// RepositorySummary is the stable JSON representation of a repository.
+type RepositorySummary struct {
+	Id            int       `json:"id"`
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	JobName       string    `json:"job_name"`
+	Description   string    `json:"description"`
+	HtmlUrl       Url       `json:"html_url"`
+	Private       bool      `json:"private"`
+	Fork          bool      `json:"fork"`
+	Language      string    `json:"language"`
+	DefaultBranch string    `json:"default_branch"`
+	PushedAt      time.Time `json:"pushed_at"`
+}
+
+// RepositoryList is the JSON representation of the repository listing.
+type RepositoryList struct {
+	Order        string              `json:"order"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	RefreshError string              `json:"refresh_error,omitempty"`
+	Repositories []RepositorySummary `json:"repositories"`
+}
+
+// Summaries returns the listing in its current order.
+func (r Repositories) Summaries() []RepositorySummary {
+	summaries := make([]RepositorySummary, 0, len(r))
+	for i := range r {
+		repo := &r[i]
+		summaries = append(summaries, RepositorySummary{
+			Id:            repo.Id,
+			Name:          repo.Name,
+			FullName:      repo.FullName,
+			JobName:       repo.JobName(),
+			Description:   repo.Description,
+			HtmlUrl:       repo.HtmlUrl,
+			Private:       repo.Private,
+			Fork:          repo.Fork,
+			Language:      repo.Language,
+			DefaultBranch: repo.DefaultBranch,
+			PushedAt:      repo.PushedAt,
+		})
+	}
+	return summaries
+}
+
 func (r ByFullName) Less(i, j int) bool {
 	return r.Repositories[i].FullName < r.Repositories[j].FullName
 }
@@ -165,6 +217,51 @@ type GithubPushPayload struct {
 	Organization Organization
 }
 
+const refHeadsPrefix = "refs/heads/"
+
+// Branch is the short name of the pushed ref (e.g. master for refs/heads/master).
+func (p *GithubPushPayload) Branch() string {
+	return strings.TrimPrefix(p.Ref, refHeadsPrefix)
+}
+
+type PullRequestRef struct {
+	Label string
+	Ref   string
+	Sha   string
+	Repo  Repository
+}
+
+type PullRequest struct {
+	Id             int
+	Number         int
+	State          string
+	Title          string
+	HtmlUrl        Url `json:"html_url"`
+	Head           PullRequestRef
+	Base           PullRequestRef
+	Merged         bool
+	MergeCommitSha string `json:"merge_commit_sha"`
+	User           Sender
+}
+
+type GithubPullRequestPayload struct {
+	Action      string
+	Number      int
+	PullRequest PullRequest `json:"pull_request"`
+	Repository  Repository
+	Sender      Sender
+}
+
+// HeadRef is the pull request head as fetched by the Jenkins job refspec.
+func (p *GithubPullRequestPayload) HeadRef() string {
+	return fmt.Sprintf("pull/%v/head", p.Number)
+}
+
+// MergeRef is the GitHub generated merge of the head into the base branch.
+func (p *GithubPullRequestPayload) MergeRef() string {
+	return fmt.Sprintf("pull/%v/merge", p.Number)
+}
+
 type GithubPingPayload struct {
 	Zen    string
 	HookId int
@@ -194,20 +291,31 @@ type GithubPingPayload struct {
 }
 
 func NewGithub(config *Config) (client *GithubClient) {
-	if config == nil || config.Github == nil || config.Github.Token == "" {
+	if config == nil || config.Github == nil {
 		return nil
 	}
 
-	oa2conf := &oauth2.Config{
-		Scopes:   []string{},
-		Endpoint: github.Endpoint,
+	ts := githubTokenSource(config)
+	if ts == nil {
+		return nil
 	}
 
-	token := &oauth2.Token{
-		AccessToken: config.Github.Token,
-	}
+	return newGithubClient(config, ts, githubRateLimit, githubIdentity(config.Github))
+}
 
-	wc := oa2conf.Client(oauth2.NoContext, token)
+// NewGithubUser is a client acting as the signed in user with their OAuth
+// token. Each token has its own quota so it is tracked apart from Lanky's.
+func NewGithubUser(config *Config, token string) *GithubClient {
+	return newGithubClient(config, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), &RateTracker{}, tokenIdentity(token))
+}
+
+func newGithubClient(config *Config, ts oauth2.TokenSource, limit *RateTracker, identity string) *GithubClient {
+	wc := &http.Client{
+		Transport: &instrumentedTransport{"github", &oauth2.Transport{
+			Source: ts,
+			Base:   &githubTransport{limit, githubEtags, identity, rateLimitWait(config), http.DefaultTransport},
+		}},
+	}
 
 	return &GithubClient{
 		config,
@@ -242,26 +350,37 @@ const (
 )
 
 type Hook struct {
-	Id      int
-	Url     Url
-	TestUrl Url `json:"test_url"`
-	PingUrl Url `json:"ping_url"`
-	Name    string
-	Events  []string
-	Active  bool
-	Config  struct {
-		Url         Url
-		ContentType string `json:"content_type"`
-	}
+	Id        int
+	Url       Url
+	TestUrl   Url `json:"test_url"`
+	PingUrl   Url `json:"ping_url"`
+	Name      string
+	Events    []string
+	Active    bool
+	Config    HookConfig
 	UpdatedAt time.Time
 	CreatedAt time.Time
 }
 
+type HookConfig struct {
+	Url         Url    `json:"url"`
+	ContentType string `json:"content_type"`
+	Secret      string `json:"secret,omitempty"`
+}
+
 type Hooks []Hook
 
+// HookRequest is the body used to create or edit a repository hook.
+type HookRequest struct {
+	Name   string     `json:"name,omitempty"`
+	Active bool       `json:"active"`
+	Events []string   `json:"events"`
+	Config HookConfig `json:"config"`
+}
+
 func (gc *GithubClient) ListHooks(fullName string, hooks *Hooks) (err error) {
 	c := cap(*hooks)
-	hookPath := fmt.Sprintf("https://api.github.com/repos/%v/hooks?per_page=%v", fullName, c)
+	hookPath := gc.apiUrl("/repos/%v/hooks?per_page=%v", fullName, c)
 
 	resp, err := gc.WebClient.Get(hookPath)
 	if err != nil {
@@ -278,9 +397,160 @@ func (gc *GithubClient) ListHooks(fullName string, hooks *Hooks) (err error) {
 	return nil
 }
 
+func (gc *GithubClient) CreateHook(fullName string, hook *HookRequest) (err error) {
+	hookPath := gc.apiUrl("/repos/%v/hooks", fullName)
+
+	b, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	resp, err := gc.WebClient.Post(hookPath, jsonContentType, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Unexpected response %v from %v.", resp.Status, hookPath)
+	}
+
+	return nil
+}
+
+func (gc *GithubClient) EditHook(fullName string, id int, hook *HookRequest) (err error) {
+	hookPath := gc.apiUrl("/repos/%v/hooks/%v", fullName, id)
+
+	b, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PATCH", hookPath, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", jsonContentType)
+
+	resp, err := gc.WebClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response %v from %v.", resp.Status, hookPath)
+	}
+
+	return nil
+}
+
+func (gc *GithubClient) GetRepository(fullName string, repo *Repository) (err error) {
+	repoPath := gc.apiUrl("/repos/%v", fullName)
+
+	resp, err := gc.WebClient.Get(repoPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("Repository %v does not exist.", fullName)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	return dec.Decode(repo)
+}
+
+// CanAccess reports whether the client's token can read the named repository.
+func (gc *GithubClient) CanAccess(fullName string) (bool, error) {
+	repoPath := gc.apiUrl("/repos/%v", fullName)
+
+	resp, err := gc.WebClient.Get(repoPath)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusForbidden:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unexpected response %v from %v.", resp.Status, repoPath)
+}
+
+const (
+	statePending = "pending"
+	stateSuccess = "success"
+	stateFailure = "failure"
+	stateError   = "error"
+
+	commitStatusContext = "lanky"
+	jsonContentType     = "application/json"
+)
+
+type CommitStatus struct {
+	State       string `json:"state"`
+	TargetUrl   Url    `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context,omitempty"`
+}
+
+// Expand substitutes a single URI template parameter such as {sha}.
+func (u Url) Expand(name, value string) Url {
+	return Url(strings.Replace(string(u), "{"+name+"}", value, -1))
+}
+
+// apiUrl is the API endpoint for path, which may contain fmt verbs for a.
+func (gc *GithubClient) apiUrl(path string, a ...interface{}) string {
+	var g *Github
+	if gc.Config != nil {
+		g = gc.Config.Github
+	}
+	return g.ApiBaseUrl() + fmt.Sprintf(path, a...)
+}
+
+// StatusesUrl is the commit statuses URL template for the named repository.
+func (gc *GithubClient) StatusesUrl(fullName string) Url {
+	return Url(gc.apiUrl("/repos/%v/statuses/{sha}", fullName))
+}
+
+func (gc *GithubClient) CreateStatus(statusesUrl Url, sha string, status *CommitStatus) (err error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	statusPath := string(statusesUrl.Expand("sha", sha))
+	resp, err := gc.WebClient.Post(statusPath, jsonContentType, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("Unexpected response %v from %v.", resp.Status, statusPath)
+	}
+
+	return nil
+}
+
 func (gc *GithubClient) ListRepositories(org string, repos *Repositories) (err error) {
 	c := cap(*repos)
-	repoPath := fmt.Sprintf("https://api.github.com/orgs/%v/repos?per_page=%v", org, c)
+	return gc.listRepositories(gc.apiUrl("/orgs/%v/repos?per_page=%v", org, c), c, repos)
+}
+
+// ListUserRepositories lists the private repositories the authenticated user can access.
+func (gc *GithubClient) ListUserRepositories(repos *Repositories) (err error) {
+	return gc.listRepositories(gc.apiUrl("/user/repos?visibility=private&per_page=%v", userReposPageSize), userReposPageSize, repos)
+}
+
+const userReposPageSize = 100
+
+func (gc *GithubClient) listRepositories(repoPath string, c int, repos *Repositories) (err error) {
 	// TODO: (NF 2015-04-05) put a reasonable limit of say 2000 repositories
 	for {
 		repositories := make(Repositories, 0, c)
@@ -309,3 +579,41 @@ func (gc *GithubClient) ListRepositories(org string, repos *Repositories) (err e
 
 	return nil
 }
+
+// CurrentUser is the user the client's token belongs to.
+func (gc *GithubClient) CurrentUser(user *Sender) (err error) {
+	userPath := gc.apiUrl("/user")
+
+	resp, err := gc.WebClient.Get(userPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response %v from %v.", resp.Status, userPath)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(user)
+}
+
+// IsMember reports whether login belongs to org, including private memberships
+// visible to the client's token.
+func (gc *GithubClient) IsMember(org, login string) (bool, error) {
+	memberPath := gc.apiUrl("/orgs/%v/members/%v", org, login)
+
+	resp, err := gc.WebClient.Get(memberPath)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Unexpected response %v from %v.", resp.Status, memberPath)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"testing"
@@ -499,6 +500,9 @@ func Test_NewGithub_with_valid_token(t *testing.T) {
 type TestClient struct {
 	responses []string
 	urls      []string
+	bodies    []string
+	status    int
+	header    http.Header
 }
 
 func newClient() *TestClient {
@@ -533,7 +537,35 @@ func (tc *TestClient) Get(url string) (*http.Response, error) {
 }
 
 func (tc *TestClient) Post(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
-	return nil, nil
+	if tc.status == 0 {
+		return nil, errors.New("No response specified")
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.urls = append(tc.urls, url)
+	tc.bodies = append(tc.bodies, string(b))
+
+	resp = &http.Response{
+		StatusCode: tc.status,
+		Status:     http.StatusText(tc.status),
+		Header:     tc.header,
+		Body:       &closer{strings.NewReader("")},
+	}
+
+	return resp, nil
+}
+
+func (tc *TestClient) Do(req *http.Request) (resp *http.Response, err error) {
+	body := req.Body
+	if body == nil {
+		body = &closer{strings.NewReader("")}
+	}
+
+	return tc.Post(req.URL.String(), req.Header.Get("Content-Type"), body)
 }
 
 func Test_ListHooks_with_connection_error_should_return_error(t *testing.T) {
@@ -658,3 +690,193 @@ func Test_ListRepositories_with_single_valid_json_response_should_return_reposit
 		t.Fatalf(".FullName = %v, want %v", repos[0].FullName, expectedName)
 	}
 }
+
+func Test_JobName_should_use_name_and_id(t *testing.T) {
+	r := &Repository{Id: 28084179, Name: "releases-web"}
+
+	expected := "releases-web-28084179"
+	if r.JobName() != expected {
+		t.Fatalf("r.JobName() = %v, want %v", r.JobName(), expected)
+	}
+}
+
+var branchTable = []struct {
+	ref      string
+	expected string
+}{
+	{"refs/heads/master", "master"},
+	{"refs/heads/feature/foo", "feature/foo"},
+	{"refs/tags/v1.0", "refs/tags/v1.0"},
+}
+
+func Test_Branch(t *testing.T) {
+	for _, tt := range branchTable {
+		p := &GithubPushPayload{Ref: tt.ref}
+
+		if p.Branch() != tt.expected {
+			t.Fatalf("p.Branch() = %v, want %v", p.Branch(), tt.expected)
+		}
+	}
+}
+
+func Test_Expand_should_replace_template_parameter(t *testing.T) {
+	var u Url = "https://api.github.com/repos/octocat/Hello-World/statuses/{sha}"
+
+	var expected Url = "https://api.github.com/repos/octocat/Hello-World/statuses/abc123"
+	if u.Expand("sha", "abc123") != expected {
+		t.Fatalf("u.Expand(\"sha\", \"abc123\") = %v, want %v", u.Expand("sha", "abc123"), expected)
+	}
+}
+
+func Test_CreateStatus_should_post_status(t *testing.T) {
+	tc := newClient()
+	tc.status = http.StatusCreated
+	gc := &GithubClient{
+		WebClient: tc,
+	}
+
+	status := &CommitStatus{State: "success", Context: "lanky"}
+	err := gc.CreateStatus(gc.StatusesUrl("octocat/Hello-World"), "abc123", status)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedUrl := "https://api.github.com/repos/octocat/Hello-World/statuses/abc123"
+	if tc.urls[0] != expectedUrl {
+		t.Fatalf("tc.urls[0] = %v, want %v", tc.urls[0], expectedUrl)
+	}
+
+	expectedBody := `{"state":"success","context":"lanky"}`
+	if tc.bodies[0] != expectedBody {
+		t.Fatalf("tc.bodies[0] = %v, want %v", tc.bodies[0], expectedBody)
+	}
+}
+
+func Test_CreateStatus_with_unexpected_status_should_return_error(t *testing.T) {
+	tc := newClient()
+	tc.status = http.StatusUnprocessableEntity
+	gc := &GithubClient{
+		WebClient: tc,
+	}
+
+	status := &CommitStatus{State: "success"}
+	err := gc.CreateStatus(gc.StatusesUrl("octocat/Hello-World"), "abc123", status)
+	if err == nil {
+		t.Fatal("err = nil, want error")
+	}
+}
+
+func Test_GetRepository_with_valid_response(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validRepositoriesResponse[1:len(validRepositoriesResponse)-1])
+	gc := &GithubClient{
+		WebClient: tc,
+	}
+
+	repo := &Repository{}
+	err := gc.GetRepository("octocat/Hello-World", repo)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedUrl := "https://api.github.com/repos/octocat/Hello-World"
+	if tc.urls[0] != expectedUrl {
+		t.Fatalf("tc.urls[0] = %v, want %v", tc.urls[0], expectedUrl)
+	}
+
+	expectedName := "octocat/Hello-World"
+	if repo.FullName != expectedName {
+		t.Fatalf("repo.FullName = %v, want %v", repo.FullName, expectedName)
+	}
+}
+
+func Test_GetRepository_should_use_enterprise_api_url(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validRepositoriesResponse[1:len(validRepositoriesResponse)-1])
+	gc := &GithubClient{
+		Config:    &Config{Github: &Github{ApiUrl: "https://ghe.example.com"}},
+		WebClient: tc,
+	}
+
+	err := gc.GetRepository("octocat/Hello-World", &Repository{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedUrl := "https://ghe.example.com/api/v3/repos/octocat/Hello-World"
+	if tc.urls[0] != expectedUrl {
+		t.Fatalf("tc.urls[0] = %v, want %v", tc.urls[0], expectedUrl)
+	}
+}
+
+const validPullRequestResponse = `{
+  "action": "opened",
+  "number": 1,
+  "pull_request": {
+    "id": 34778301,
+    "number": 1,
+    "state": "open",
+    "title": "Update the README with new information",
+    "html_url": "https://github.com/baxterthehacker/public-repo/pull/1",
+    "head": {
+      "label": "baxterthehacker:changes",
+      "ref": "changes",
+      "sha": "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"
+    },
+    "base": {
+      "label": "baxterthehacker:master",
+      "ref": "master",
+      "sha": "9049f1265b7d61be4a8904a9a27120d2064dab3b"
+    },
+    "merged": false,
+    "merge_commit_sha": null
+  },
+  "repository": {
+    "id": 35129377,
+    "name": "public-repo",
+    "full_name": "baxterthehacker/public-repo"
+  },
+  "sender": {
+    "login": "baxterthehacker",
+    "id": 6752317
+  }
+}`
+
+func Test_should_process_valid_pull_request_correctly(t *testing.T) {
+	pr := &GithubPullRequestPayload{}
+
+	err := json.Unmarshal([]byte(validPullRequestResponse), pr)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedSha := "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"
+	if pr.PullRequest.Head.Sha != expectedSha {
+		t.Fatalf("pr.PullRequest.Head.Sha = %v, want %v", pr.PullRequest.Head.Sha, expectedSha)
+	}
+
+	if pr.HeadRef() != "pull/1/head" {
+		t.Fatalf("pr.HeadRef() = %v, want pull/1/head", pr.HeadRef())
+	}
+
+	if pr.MergeRef() != "pull/1/merge" {
+		t.Fatalf("pr.MergeRef() = %v, want pull/1/merge", pr.MergeRef())
+	}
+}
+
+func Test_Repositories_Summaries_should_keep_order_and_job_name(t *testing.T) {
+	repos := Repositories{{Id: 2, Name: "b", FullName: "o/b"}, {Id: 1, Name: "a", FullName: "o/a"}}
+
+	summaries := repos.Summaries()
+	if len(summaries) != 2 {
+		t.Fatalf("len(summaries) = %v, want %v", len(summaries), 2)
+	}
+
+	if summaries[0].FullName != "o/b" {
+		t.Fatalf("summaries[0].FullName = %v, want %v", summaries[0].FullName, "o/b")
+	}
+
+	if summaries[1].JobName != "a-1" {
+		t.Fatalf("summaries[1].JobName = %v, want %v", summaries[1].JobName, "a-1")
+	}
+}
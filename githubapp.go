@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHub rejects App JWTs valid for more than 10 minutes.
+	appJwtLifetime = 9 * time.Minute
+	// installation tokens last an hour and are refreshed this long before expiry.
+	installationTokenMargin = 5 * time.Minute
+)
+
+// appJWT is the RS256 signed token identifying the GitHub App. It is backdated
+// a minute to allow for clock drift.
+func appJWT(appId int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJwtLifetime).Unix(),
+		"iss": appId,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parsePrivateKey decodes a PEM encoded PKCS#1 or PKCS#8 RSA private key.
+func parsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("Private key is not PEM encoded.")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Private key is not an RSA key.")
+	}
+
+	return rsaKey, nil
+}
+
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrivateKey(b)
+}
+
+// installationTokenSource exchanges App JWTs for an organization's
+// installation token, caching it until shortly before it expires.
+type installationTokenSource struct {
+	sync.Mutex
+	appId          int64
+	key            *rsa.PrivateKey
+	organization   string
+	installationId int64
+	apiUrl         string
+	client         *http.Client
+	token          *oauth2.Token
+	now            func() time.Time
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != nil && s.now().Add(installationTokenMargin).Before(s.token.Expiry) {
+		return s.token, nil
+	}
+
+	jwt, err := appJWT(s.appId, s.key, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if s.installationId == 0 {
+		installation := &struct{ Id int64 }{}
+		err = s.call("GET", fmt.Sprintf("%v/orgs/%v/installation", s.apiUrl, s.organization), jwt, http.StatusOK, installation)
+		if err != nil {
+			return nil, err
+		}
+		s.installationId = installation.Id
+	}
+
+	access := &struct {
+		Token     string
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	err = s.call("POST", fmt.Sprintf("%v/app/installations/%v/access_tokens", s.apiUrl, s.installationId), jwt, http.StatusCreated, access)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = &oauth2.Token{AccessToken: access.Token, TokenType: "token", Expiry: access.ExpiresAt}
+	return s.token, nil
+}
+
+func (s *installationTokenSource) call(method, url, jwt string, expected int, v interface{}) error {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		return fmt.Errorf("GitHub App authentication failed with %v from %v.", resp.Status, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fallbackTokenSource uses the personal token when the App token is unavailable.
+type fallbackTokenSource struct {
+	primary  oauth2.TokenSource
+	fallback oauth2.TokenSource
+}
+
+func (s *fallbackTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.primary.Token()
+	if err == nil {
+		return token, nil
+	}
+
+	glog.Warningf("Falling back to the GitHub token: %v", err)
+	return s.fallback.Token()
+}
+
+// appTokenSources are shared across clients so installation tokens outlive a request.
+var appTokenSources = struct {
+	sync.Mutex
+	sources map[string]*installationTokenSource
+}{sources: make(map[string]*installationTokenSource)}
+
+func appTokenSource(config *Config) (*installationTokenSource, error) {
+	g := config.Github
+	cacheKey := fmt.Sprintf("%v|%v|%v|%v|%v", g.ApiBaseUrl(), g.AppId, g.InstallationId, g.Organization, g.PrivateKeyPath)
+
+	appTokenSources.Lock()
+	defer appTokenSources.Unlock()
+
+	if ts, ok := appTokenSources.sources[cacheKey]; ok {
+		return ts, nil
+	}
+
+	key, err := readPrivateKey(g.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &installationTokenSource{
+		appId:          g.AppId,
+		key:            key,
+		organization:   g.Organization,
+		installationId: g.InstallationId,
+		apiUrl:         g.ApiBaseUrl(),
+		client: &http.Client{
+			Timeout:   config.ClientTimeout(),
+			Transport: &instrumentedTransport{"github", http.DefaultTransport},
+		},
+		now: time.Now,
+	}
+	appTokenSources.sources[cacheKey] = ts
+
+	return ts, nil
+}
+
+// githubTokenSource authenticates as the GitHub App when configured, otherwise
+// with the personal token. It is nil when neither is configured.
+func githubTokenSource(config *Config) oauth2.TokenSource {
+	g := config.Github
+	var static oauth2.TokenSource
+	if g.Token != "" {
+		static = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: g.Token})
+	}
+
+	if !g.IsApp() {
+		return static
+	}
+
+	ts, err := appTokenSource(config)
+	if err != nil {
+		glog.Errorf("Unable to configure GitHub App %v: %v", g.AppId, err)
+		return static
+	}
+
+	if static == nil {
+		return ts
+	}
+
+	return &fallbackTokenSource{ts, static}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func newAppKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	return key
+}
+
+func Test_appJWT_should_sign_claims_with_RS256(t *testing.T) {
+	key := newAppKey(t)
+	now := time.Unix(1500000000, 0)
+
+	jwt, err := appJWT(42, key, now)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("len(parts) = %v, want %v", len(parts), 3)
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := map[string]int64{}
+	json.Unmarshal(b, &claims)
+
+	if claims["iss"] != 42 || claims["iat"] != now.Unix()-60 || claims["exp"] != now.Add(appJwtLifetime).Unix() {
+		t.Fatalf("claims = %v, want iss 42 and a 10 minute window", claims)
+	}
+}
+
+func Test_parsePrivateKey_should_accept_pkcs1_and_pkcs8(t *testing.T) {
+	key := newAppKey(t)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	for _, block := range []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := parsePrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("%v err = %v, want nil", block.Type, err)
+		}
+
+		if !parsed.Equal(key) {
+			t.Fatalf("%v parsed key differs", block.Type)
+		}
+	}
+
+	_, err := parsePrivateKey([]byte("not a key"))
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+}
+
+func newAppServer(t *testing.T, exchanges *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("Authorization = %v, want Bearer JWT", r.Header.Get("Authorization"))
+		}
+
+		switch r.URL.Path {
+		case "/orgs/baxterthehacker/installation":
+			fmt.Fprint(w, `{"id": 7}`)
+		case "/app/installations/7/access_tokens":
+			*exchanges++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": "ghs_%v", "expires_at": "2017-07-14T03:40:00Z"}`, *exchanges)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_installationTokenSource_should_cache_until_near_expiry(t *testing.T) {
+	var exchanges int
+	ts := newAppServer(t, &exchanges)
+	defer ts.Close()
+
+	now := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	s := &installationTokenSource{
+		appId:        42,
+		key:          newAppKey(t),
+		organization: "baxterthehacker",
+		apiUrl:       ts.URL,
+		client:       http.DefaultClient,
+		now:          func() time.Time { return now },
+	}
+
+	for i, expected := range []string{"ghs_1", "ghs_1", "ghs_2"} {
+		if i == 2 {
+			now = now.Add(56 * time.Minute)
+		}
+
+		token, err := s.Token()
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+
+		if token.AccessToken != expected {
+			t.Fatalf("%v token.AccessToken = %v, want %v", i, token.AccessToken, expected)
+		}
+	}
+
+	if s.installationId != 7 {
+		t.Fatalf("s.installationId = %v, want %v", s.installationId, 7)
+	}
+}
+
+type failingTokenSource struct{}
+
+func (failingTokenSource) Token() (*oauth2.Token, error) { return nil, errors.New("unavailable") }
+
+func Test_fallbackTokenSource_should_use_personal_token(t *testing.T) {
+	s := &fallbackTokenSource{failingTokenSource{}, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "abc123"})}
+
+	token, err := s.Token()
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if token.AccessToken != "abc123" {
+		t.Fatalf("token.AccessToken = %v, want %v", token.AccessToken, "abc123")
+	}
+}
+
+func Test_githubTokenSource_without_credentials_should_be_nil(t *testing.T) {
+	if ts := githubTokenSource(&Config{Github: &Github{}}); ts != nil {
+		t.Fatalf("githubTokenSource() = %v, want nil", ts)
+	}
+}
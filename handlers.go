@@ -3,209 +3,35 @@ package main
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
+
+	"github.com/golang/glog"
 )
 
 const githubEventType = "X-GitHub-Event"
+const githubDelivery = "X-GitHub-Delivery"
 const githubSignature = "X-Hub-Signature"
 const githubSignaturePrefix = "sha1="
+const githubSignature256 = "X-Hub-Signature-256"
+const githubSignature256Prefix = "sha256="
 const githubUserAgent = "GitHub-Hookshot/"
-const statusHtml = `<!DOCTYPE html>
-<html lang="en">
-  <head>
-  <meta charset="utf-8">
-  <meta name="viewport" content="width=device-width, initial-scale=1">
-	<title>Lanky</title>
-	<style>
-	html {
-		font-size:62.5%;
-	}
-	body {
-		color:#222;
-		font-family: HelveticaNeue, 'Helvetica Neue', Helvetica, Arial, sans-serif;
-		font-size:1.5em;
-		margin:1rem auto;
-		position:relative;
-		width:960px;
-	}
-	ul {
-		margin:0;
-		padding:0;
-	}
-	li {
-		list-style:none;
-		line-height:4rem;
-		height:4rem;
-		margin-bottom:1px;
-	}
-	th {
-		text-align:left;
-	}
-	.number {
-		text-align:right;
-	}
-	.key {
-		min-width:10rem;
-	}
-	</style>
-	</head>
-	<body>
-	<h1>Lanky</h1>
-	<table>
-	<tr><th class=key>Key</th><th>Value</th></tr>
-	<tr><td>Started</td><td>{{.StartDate}}</td></tr>
-	<tr><td>Version</td><td class=number>{{.Version}}</td></tr>
-	<tr><td># Goroutines</td><td class=number>{{.NumGoroutine}}</td></tr>
-	<tr><td>1XX</td><td class=number>{{.Status1xx}}</td></tr>
-	<tr><td>2XX</td><td class=number>{{.Status2xx}}</td></tr>
-	<tr><td>3XX</td><td class=number>{{.Status3xx}}</td></tr>
-	<tr><td>4XX</td><td class=number>{{.Status4xx}}</td></tr>
-	<tr><td>5XX</td><td class=number>{{.Status5xx}}</td></tr>
-	<tr><td>Bytes from System</td><td class=number>{{.Sys}}</td></tr>
-	<tr><td>Heap in Use</td><td class=number>{{.HeapInuse}}</td></tr>
-	<tr><td>Heap System</td><td class=number>{{.HeapSys}}</td></tr>
-	<tr><td>Total Allocation</td><td class=number>{{.TotalAlloc}}</td></tr>
-	</table>
-	</body>
-</html>`
-
-const rootHtml = `<!DOCTYPE html>
-<html lang="en">
-  <head>
-  <meta charset="utf-8">
-  <meta name="viewport" content="width=device-width, initial-scale=1">
-	<title>Lanky</title>
-	<link href="//fonts.googleapis.com/css?family=Raleway:400,300,600" rel="stylesheet" type="text/css">
-	<style>
-	html {
-		font-size:62.5%;
-	}
-	body {
-		color:#222;
-		font-family: Raleway, HelveticaNeue, 'Helvetica Neue', Helvetica, Arial, sans-serif;
-		font-size:1.5em;
-		margin:1rem auto;
-		position:relative;
-		width:960px;
-	}
-	ul {
-		margin:0;
-		padding:0;
-	}
-	li {
-		list-style:none;
-		line-height:4rem;
-		height:4rem;
-		margin-bottom:1px;
-	}
-	a {
-		color:#1EAEDB;
-	}
-	ul a {
-		background:#eee;
-		display:block;
-		text-decoration:none;
-		text-indent:1rem;
-	}
-	.Success a {
-		background:#517F1A;
-		color:white;
-	}
-	.Failure a {
-		background:#B2123F;
-		color:white;
-	}
-	a:hover {
-		background:#ccc;
-	}
-	</style>
-	</head>
-	<body>
-	<h1>Lanky</h1>
-	<p>Last {{.Len}} builds sorted by:
-	{{if .ByDate}}
-	date, <a href="?by=status">status</a>
-	{{else}}
-	<a href="?by=date">date</a>, status
-	{{end}}
-	</p>
-	<ul>
-	{{range .Project}}
-	<li class="{{.LastBuildStatus}}"><a href="{{.ConsoleUrl}}">{{.BuildTime}} - {{.Name}} (#{{.LastBuildLabel}})</a>
-	{{end}}
-	</ul>
-	</body>
-</html>`
-
-const repositoryHtml = `<!DOCTYPE html>
-<html lang="en">
-<head>
-<meta charset="utf-8">
-<meta name="viewport" content="width=device-width, initial-scale=1">
-<title>Lanky</title>
-<link href="//fonts.googleapis.com/css?family=Raleway:400,300,600" rel="stylesheet" type="text/css">
-<style>
-html {
-	font-size:62.5%;
-}
-body {
-	color:#222;
-	font-family: Raleway, HelveticaNeue, 'Helvetica Neue', Helvetica, Arial, sans-serif;
-	font-size:1.5em;
-	margin:1rem auto;
-	position:relative;
-	width:960px;
-}
-ul {
-	margin:0;
-	padding:0;
-}
-li {
-	list-style:none;
-	line-height:4rem;
-	height:4rem;
-	margin-bottom:1px;
-}
-a {
-	color:#1EAEDB;
-}
-ul a {
-	background:#eee;
-	display:block;
-	text-decoration:none;
-	text-indent:1rem;
-}
-</style>
-</head>
-<body>
-<h1>Lanky</h1>
-<p>{{.Len}} repositories.</p>
-<ul>
-{{range .}}
-<li>{{.FullName}}
-{{end}}
-</ul>
-</body>
-</html>`
-
-var rootTemplate = template.Must(template.New("root").Parse(rootHtml))
-var statusTemplate = template.Must(template.New("status").Parse(statusHtml))
-var repositoryTemplate = template.Must(template.New("repository").Parse(repositoryHtml))
+const bearerPrefix = "Bearer "
 
 func statusHandler(w http.ResponseWriter, r *http.Request, config *Config, stats *RuntimeStats) error {
 	stats.Update()
 
 	// lock all of the reads to ensure a consistent point in time measurement
 	stats.RLock()
-	err := statusTemplate.Execute(w, stats)
+	err := templates.Execute(w, "status", stats)
 	stats.RUnlock()
 
 	if err != nil {
@@ -215,8 +41,23 @@ func statusHandler(w http.ResponseWriter, r *http.Request, config *Config, stats
 	return nil
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
-	if r.URL.Path != "/" {
+// acceptsJson reports whether the client asked for JSON in the Accept header.
+func acceptsJson(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), jsonContentType)
+}
+
+// wantsJson reports whether the client asked for JSON via Accept or a .json suffix.
+func wantsJson(r *http.Request) bool {
+	return acceptsJson(r) || strings.HasSuffix(r.URL.Path, jsonSuffix)
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", jsonContentType)
+	return json.NewEncoder(w).Encode(v)
+}
+
+func rootHandler(w http.ResponseWriter, r *http.Request, config *Config, cache *RepositoryCache) error {
+	if r.URL.Path != "/" && r.URL.Path != "/index"+jsonSuffix {
 		http.NotFound(w, r)
 		return nil
 	}
@@ -233,7 +74,18 @@ func rootHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
 		return err
 	}
 
-	err = rootTemplate.Execute(w, p)
+	hidden, err := hiddenProjects(config, SessionFrom(r), cache)
+	if err != nil {
+		return err
+	}
+	p.Hide(hidden)
+
+	w.Header().Set("Vary", "Accept")
+	if wantsJson(r) {
+		return writeJson(w, p)
+	}
+
+	err = templates.Execute(w, "root", p)
 	if err != nil {
 		return err
 	}
@@ -241,8 +93,60 @@ func rootHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
 	return nil
 }
 
-func builderHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
-	http.Error(w, "Not implemented yet", http.StatusInternalServerError)
+func builderHandler(w http.ResponseWriter, r *http.Request, config *Config, builds BuildStore) (err error) {
+	if r.Method != "POST" {
+		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if config.Jenkins == nil || config.Jenkins.NotifySecret == "" {
+		return errors.New("Jenkins configuration is invalid.")
+	}
+
+	token := r.URL.Query().Get("token")
+	if !secureCompare(token, config.Jenkins.NotifySecret) {
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return
+	}
+
+	n := &JenkinsNotification{}
+	dec := json.NewDecoder(r.Body)
+	err = dec.Decode(n)
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "Invalid notification payload.", http.StatusBadRequest)
+		return nil
+	}
+
+	if n.Sha() == "" || n.Repository() == "" {
+		http.Error(w, "Missing SHA or REPOSITORY parameter.", http.StatusBadRequest)
+		return
+	}
+
+	if builds != nil {
+		err = builds.Notify(n, time.Now())
+		if err != nil {
+			glog.Errorf("Unable to record build %v #%v: %v", n.Name, n.Build.Number, err)
+		}
+	}
+
+	status := n.CommitStatus()
+	if status == nil {
+		fmt.Fprintf(w, "Ignored: %v phase.", n.Build.Phase)
+		return
+	}
+
+	cl := NewGithub(config)
+	if cl == nil {
+		return errors.New("Github configuration is invalid.")
+	}
+
+	err = cl.CreateStatus(cl.StatusesUrl(n.Repository()), n.Sha(), status)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "OK: %v", status.State)
 	return
 }
 
@@ -252,7 +156,107 @@ func sign(payload []byte, key string) []byte {
 	return mac.Sum(nil)
 }
 
-func githubHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
+func sign256(payload []byte, key string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+type signatureScheme struct {
+	Algorithm string
+	header    string
+	prefix    string
+	sign      func(payload []byte, key string) []byte
+}
+
+var sha256Scheme = &signatureScheme{algorithmSha256, githubSignature256, githubSignature256Prefix, sign256}
+var sha1Scheme = &signatureScheme{algorithmSha1, githubSignature, githubSignaturePrefix, sign}
+
+// requestSignature selects the SHA-256 signature when present, falling back
+// to the legacy SHA-1 signature only when allowSha1 is set.
+func requestSignature(h http.Header, allowSha1 bool) (scheme *signatureScheme, signature []byte, err error) {
+	scheme = sha256Scheme
+	header := h.Get(scheme.header)
+	if header == "" && allowSha1 {
+		scheme = sha1Scheme
+		header = h.Get(scheme.header)
+	}
+
+	if !strings.HasPrefix(header, scheme.prefix) {
+		return nil, nil, errors.New("Invalid signature.")
+	}
+
+	signature, err = hex.DecodeString(header[len(scheme.prefix):])
+	if err != nil {
+		return nil, nil, errors.New("Invalid signature.")
+	}
+
+	return scheme, signature, nil
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authorized verifies the request's basic auth credentials and asks the
+// client to authenticate when they do not match.
+func authorized(w http.ResponseWriter, r *http.Request, user, password string) bool {
+	u, p, ok := r.BasicAuth()
+	if ok && secureCompare(u, user) && secureCompare(p, password) {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="Lanky"`)
+	http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+	return false
+}
+
+// adminAuthorized accepts the admin bearer token or basic auth credentials,
+// writing a 401 response when neither matches.
+func adminAuthorized(w http.ResponseWriter, r *http.Request, admin *Admin) bool {
+	auth := r.Header.Get("Authorization")
+	if admin.Token != "" && strings.HasPrefix(auth, bearerPrefix) && secureCompare(strings.TrimPrefix(auth, bearerPrefix), admin.Token) {
+		return true
+	}
+
+	if admin.User == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="Lanky"`)
+		http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+		return false
+	}
+
+	return authorized(w, r, admin.User, admin.Password)
+}
+
+// matchSecret finds the active secret that produced the request signature.
+func matchSecret(scheme *signatureScheme, body, signature []byte, secrets []HookSecret) (secret *HookSecret, ok bool) {
+	for i := range secrets {
+		if hmac.Equal(scheme.sign(body, secrets[i].Secret), signature) {
+			return &secrets[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// eventTypeLabel keeps the metric label bounded, the header is client supplied.
+func eventTypeLabel(eventType string) string {
+	switch eventType {
+	case "push", "pull_request", "ping":
+		return eventType
+	}
+	return "other"
+}
+
+func githubHandler(w http.ResponseWriter, r *http.Request, config *Config, stats *RuntimeStats, events *EventQueue) (err error) {
+	// queued events are counted by the worker once processed
+	outcome := eventRejected
+	defer func() {
+		if outcome != "" {
+			metrics.IncEvent(eventTypeLabel(r.Header.Get(githubEventType)), outcome)
+		}
+	}()
+
 	if r.Method != "POST" {
 		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
 		return
@@ -263,93 +267,348 @@ func githubHandler(w http.ResponseWriter, r *http.Request, config *Config) (err
 		return
 	}
 
-	signatureHeader := r.Header.Get(githubSignature)
-	if !strings.HasPrefix(signatureHeader, githubSignaturePrefix) {
-		http.Error(w, "Invalid signature.", http.StatusBadRequest)
-		return
-	}
-
-	reqSignature, err := hex.DecodeString(signatureHeader[len(githubSignaturePrefix):])
+	allowSha1 := config.Github != nil && config.Github.AllowSha1
+	scheme, reqSignature, err := requestSignature(r.Header, allowSha1)
 	if err != nil {
-		http.Error(w, "Invalid signature.", http.StatusBadRequest)
-		return
+		outcome = eventInvalidSignature
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	r.Body.Close()
 	if err != nil {
+		outcome = eventError
 		http.Error(w, "Unable to read message body.", http.StatusInternalServerError)
 		return
 	}
 
-	localSignature := sign(body, config.Github.HookSecret)
-	if !hmac.Equal(localSignature, reqSignature) {
+	secret, ok := matchSecret(scheme, body, reqSignature, config.Github.ActiveHookSecrets(time.Now()))
+	if !ok {
+		outcome = eventInvalidSignature
 		http.Error(w, "Invalid signature.", http.StatusBadRequest)
 		return
 	}
+	event := &Event{
+		Type:     r.Header.Get(githubEventType),
+		Delivery: r.Header.Get(githubDelivery),
+		Body:     body,
+	}
+	stats.IncSignature(scheme.Algorithm)
+	stats.IncSecret(secret.Name)
+	glog.Infof("GitHub %v delivery %v verified with %v using %v.", event.Type, event.Delivery, scheme.Algorithm, secret.Name)
 
-	event := r.Header.Get(githubEventType)
-	switch event {
-	case "push":
-		http.Error(w, "Not implemented yet", http.StatusInternalServerError)
-		return
+	switch event.Type {
+	case "push", "pull_request":
+		break
 	case "ping":
+		outcome = eventPing
 		fmt.Fprint(w, "OK: 1")
 		return
+	default:
+		outcome = eventUnsupported
+		http.Error(w, "Invalid event type specified.", http.StatusBadRequest)
+		return
 	}
 
-	http.Error(w, "Invalid event type specified.", http.StatusBadRequest)
-	return
+	if !json.Valid(body) {
+		outcome = eventInvalidPayload
+		http.Error(w, "Invalid payload.", http.StatusBadRequest)
+		return
+	}
+
+	err = events.Enqueue(event)
+	switch err {
+	case nil:
+		outcome = ""
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "Accepted: %v", event.Delivery)
+		return nil
+	case ErrDuplicateDelivery:
+		outcome = eventDuplicate
+		fmt.Fprint(w, "duplicate")
+		return nil
+	case ErrQueueFull:
+		outcome = eventQueueFull
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil
+	case ErrQueueClosed:
+		outcome = eventQueueClosed
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil
+	}
+
+	outcome = eventError
+	return err
 }
 
-func hubotHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
-	http.Error(w, "Not implemented yet", http.StatusInternalServerError)
+func hubotHandler(w http.ResponseWriter, r *http.Request, config *Config, builds BuildStore) (err error) {
+	if r.Method != "POST" {
+		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if config.Hubot == nil || config.Hubot.User == "" {
+		return errors.New("Hubot configuration is invalid.")
+	}
+
+	if !authorized(w, r, config.Hubot.User, config.Hubot.Password) {
+		return
+	}
+
+	message, err := HubotCommand(r.FormValue("command"), r.FormValue("user"), config, builds)
+	if err != nil {
+		return err
+	}
+
+	reply := &HubotReply{
+		Room:    r.FormValue("room"),
+		Message: message,
+	}
+	if reply.Room == "" {
+		reply.Room = config.ChatDefaultRoom
+	}
+
+	if acceptsJson(r) {
+		return writeJson(w, reply)
+	}
+
+	w.Header().Set(hubotRoomHeader, reply.Room)
+	fmt.Fprint(w, reply.Message)
 	return
 }
 
-var repos *Repositories = new(Repositories)
-var lastUpdated time.Time
-var reposSync sync.Mutex
-var reposSwap sync.RWMutex
+func setupHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
+	if r.Method != "POST" {
+		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !config.Admin.HasCredentials() {
+		return errors.New("Admin configuration is invalid.")
+	}
+
+	if !adminAuthorized(w, r, config.Admin) {
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, "Invalid form.", http.StatusBadRequest)
+		return nil
+	}
+
+	results, err := SetupRepositories(config, r.Form["repo"])
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		fmt.Fprintln(w, result)
+	}
+
+	return nil
+}
+
+func reconcileHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
+	if r.Method != "POST" {
+		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !config.Admin.HasCredentials() {
+		return errors.New("Admin configuration is invalid.")
+	}
+
+	if !adminAuthorized(w, r, config.Admin) {
+		return
+	}
+
+	drift, err := ReconcileHooks(config)
+	if err != nil {
+		return err
+	}
+
+	for _, hd := range drift {
+		fmt.Fprintln(w, hd)
+	}
+
+	return nil
+}
+
+const (
+	jsonSuffix      = ".json"
+	orderByFullName = "full_name"
+)
 
-func repositoryHandler(w http.ResponseWriter, r *http.Request, config *Config) (err error) {
+func repositoryHandler(w http.ResponseWriter, r *http.Request, config *Config, cache *RepositoryCache) (err error) {
 	if r.Method != "GET" {
 		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
 		return
 	}
 
-	cl := NewGithub(config)
-	if cl == nil {
+	if NewGithub(config) == nil {
 		return errors.New("Github configuration is invalid.")
 	}
 
-	if r.URL.Query().Get("update") == "now" {
-		reposSync.Lock()
-		defer reposSync.Unlock()
-		now := time.Now()
-		isAfter := now.After(lastUpdated.Add(5 * time.Minute))
+	snapshot := cache.Snapshot()
+	snapshot.Repositories, err = visibleRepositories(config, SessionFrom(r), snapshot.Repositories)
+	if err != nil {
+		return err
+	}
 
-		reps := make(Repositories, 0, 100)
-		if isAfter {
-			err = cl.ListRepositories(config.Github.Organization, &reps)
-			if err != nil {
-				return err
-			}
+	w.Header().Set("Vary", "Accept")
+	if wantsJson(r) {
+		list := &RepositoryList{
+			Order:        orderByFullName,
+			UpdatedAt:    snapshot.UpdatedAt,
+			Repositories: snapshot.Repositories.Summaries(),
+		}
+		if snapshot.Error != nil {
+			list.RefreshError = snapshot.Error.Error()
+		}
+		return writeJson(w, list)
+	}
+
+	return templates.Execute(w, "repository", snapshot)
+}
 
-			lastUpdated = time.Now()
+// hiddenProjects are the Jenkins jobs of private repositories the session's
+// user cannot access. The cache is loaded first if the background refresh
+// has not succeeded yet.
+func hiddenProjects(config *Config, s *Session, cache *RepositoryCache) (map[string]bool, error) {
+	hidden := make(map[string]bool)
+	if s == nil {
+		return hidden, nil
+	}
 
-			reposSwap.Lock()
-			repos = &reps
-			reposSwap.Unlock()
+	snapshot := cache.Snapshot()
+	if !snapshot.Loaded() {
+		err := cache.Refresh(config)
+		if err != nil {
+			return nil, err
 		}
+		snapshot = cache.Snapshot()
 	}
 
-	reposSwap.RLock()
-	err = repositoryTemplate.Execute(w, *repos)
-	reposSwap.RUnlock()
+	visible, err := visibleRepositories(config, s, snapshot.Repositories)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[int]bool, len(visible))
+	for _, repo := range visible {
+		allowed[repo.Id] = true
+	}
+
+	for i := range snapshot.Repositories {
+		if !allowed[snapshot.Repositories[i].Id] {
+			hidden[snapshot.Repositories[i].JobName()] = true
+		}
+	}
+
+	return hidden, nil
+}
+
+const defaultBuildsPageLimit = 50
+
+// buildStatuses are the states a build can be filtered by.
+var buildStatuses = []string{buildQueued, statePending, stateSuccess, stateFailure, stateError}
+
+type buildsPage struct {
+	WebUrl     string
+	Repository string
+	Statuses   []string
+	Filter     *BuildFilter
+	Builds     []Build
+}
+
+// repositoryBuildsHandler lists the recent builds of /repositories/{owner}/{name}
+// from the build store or, when Lanky is stateless, the Jenkins job API.
+func repositoryBuildsHandler(w http.ResponseWriter, r *http.Request, config *Config, builds BuildStore) (err error) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repositories/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	fullName := parts[0] + "/" + parts[1]
+	if s := SessionFrom(r); s != nil {
+		ok, err := NewGithubUser(config, s.Token).CanAccess(fullName)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return nil
+		}
+	}
+
+	q := r.URL.Query()
+	f := &BuildFilter{
+		Repository: fullName,
+		Branch:     q.Get("branch"),
+		Status:     q.Get("status"),
+		Limit:      defaultBuildsPageLimit,
+	}
+
+	list, err := repositoryBuilds(config, builds, f)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	page := &buildsPage{
+		WebUrl:     config.Github.WebBaseUrl(),
+		Repository: f.Repository,
+		Statuses:   buildStatuses,
+		Filter:     f,
+		Builds:     list,
+	}
+
+	return templates.Execute(w, "builds", page)
+}
+
+// repositoryBuilds returns the builds matching f, preferring Lanky's own records.
+func repositoryBuilds(config *Config, builds BuildStore, f *BuildFilter) ([]Build, error) {
+	if builds != nil {
+		return builds.List(f)
+	}
+
+	cl := NewGithub(config)
+	if cl == nil {
+		return nil, errors.New("Github configuration is invalid.")
+	}
+
+	j := NewJenkins(config)
+	if j == nil {
+		return nil, errors.New("Jenkins configuration is invalid.")
+	}
+
+	repo := &Repository{}
+	err := cl.GetRepository(f.Repository, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := j.JobBuilds(repo.JobName(), f.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Build, 0, len(all))
+	for i := range all {
+		if all[i].Repository == "" {
+			all[i].Repository = f.Repository
+		}
+		if f.Match(&all[i]) {
+			list = append(list, all[i])
+		}
+	}
+
+	return list, nil
 }
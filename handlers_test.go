@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_repositoryHandler_should_return_without_error_with_valid_github_config(t *testing.T) {
@@ -19,7 +25,7 @@ func Test_repositoryHandler_should_return_without_error_with_valid_github_config
 		},
 	}
 
-	err := repositoryHandler(w, r, config)
+	err := repositoryHandler(w, r, config, NewRepositoryCache())
 	if err != nil {
 		t.Fatalf("err = %v, want nil", err)
 	}
@@ -34,7 +40,7 @@ func Test_repositoryHandler_should_return_error_with_invalid_github_config(t *te
 
 	w := httptest.NewRecorder()
 	config := &Config{}
-	err := repositoryHandler(w, r, config)
+	err := repositoryHandler(w, r, config, NewRepositoryCache())
 	if err == nil {
 		t.Fatalf("err = nil, want error")
 	}
@@ -50,7 +56,7 @@ func Test_repositoryHandler_should_force_http_error_when_post_method(t *testing.
 
 	w := httptest.NewRecorder()
 	config := &Config{}
-	err := repositoryHandler(w, r, config)
+	err := repositoryHandler(w, r, config, NewRepositoryCache())
 	if err != nil {
 		t.Fatalf("err = %v, want nil", err)
 	}
@@ -66,7 +72,7 @@ func Test_githubHandler_should_fail_if_not_post(t *testing.T) {
 	}
 	w := httptest.NewRecorder()
 	config := &Config{}
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusMethodNotAllowed {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusMethodNotAllowed)
@@ -81,7 +87,7 @@ func Test_githubHandler_should_fail_if_not_correct_user_agent(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	config := &Config{}
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusUnauthorized {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusUnauthorized)
@@ -94,7 +100,11 @@ func newGithubRequest(r io.Reader, signature string) (*http.Request, error) {
 		return nil, err
 	}
 	req.Header.Add("User-Agent", githubUserAgent+"1234")
-	req.Header.Add(githubSignature, signature)
+	if strings.HasPrefix(signature, githubSignature256Prefix) {
+		req.Header.Add(githubSignature256, signature)
+	} else {
+		req.Header.Add(githubSignature, signature)
+	}
 
 	return req, nil
 }
@@ -110,7 +120,7 @@ func Test_githubHandler_should_fail_if_hmac_signature_is_invalid(t *testing.T) {
 	w := httptest.NewRecorder()
 	config := &Config{}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
@@ -128,7 +138,7 @@ func Test_githubHandler_should_fail_if_hmac_signature_is_invalid_hex_encoding(t
 	w := httptest.NewRecorder()
 	config := &Config{}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
@@ -153,10 +163,11 @@ func Test_githubHandler_should_fail_if_hmac_signature_is_signed_incorrectly(t *t
 	config := &Config{
 		Github: &Github{
 			HookSecret: "abc123",
+			AllowSha1:  true,
 		},
 	}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
@@ -181,10 +192,11 @@ func Test_githubHandler_should_fail_if_event_type_absent(t *testing.T) {
 	config := &Config{
 		Github: &Github{
 			HookSecret: "abc123",
+			AllowSha1:  true,
 		},
 	}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
@@ -210,10 +222,11 @@ func Test_githubHandler_should_fail_if_event_type_invalid(t *testing.T) {
 	config := &Config{
 		Github: &Github{
 			HookSecret: "abc123",
+			AllowSha1:  true,
 		},
 	}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
@@ -239,10 +252,11 @@ func Test_githubHandler_should_succeed_with_valid_ping(t *testing.T) {
 	config := &Config{
 		Github: &Github{
 			HookSecret: "abc123",
+			AllowSha1:  true,
 		},
 	}
 
-	githubHandler(w, req, config)
+	githubHandler(w, req, config, NewStats(), newEvents())
 
 	if w.Code != http.StatusOK {
 		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusOK)
@@ -253,3 +267,567 @@ func Test_githubHandler_should_succeed_with_valid_ping(t *testing.T) {
 		t.Fatalf("w.Body = '%v', want %v", w.Body, expectedBody)
 	}
 }
+
+func newBuilderRequest(method, token, body string) *http.Request {
+	req, _ := http.NewRequest(method, "http://localhost:9393/_builder?token="+token, strings.NewReader(body))
+	return req
+}
+
+var builderConfig = &Config{
+	Jenkins: &Jenkins{
+		NotifySecret: "abc123",
+	},
+}
+
+func Test_builderHandler_should_fail_if_not_post(t *testing.T) {
+	w := httptest.NewRecorder()
+	builderHandler(w, newBuilderRequest("GET", "abc123", ""), builderConfig, nil)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func Test_builderHandler_should_return_error_without_secret(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := builderHandler(w, newBuilderRequest("POST", "", validNotification), &Config{}, nil)
+
+	if err == nil {
+		t.Fatal("err = nil, want error")
+	}
+}
+
+func Test_builderHandler_should_fail_with_invalid_token(t *testing.T) {
+	w := httptest.NewRecorder()
+	builderHandler(w, newBuilderRequest("POST", "123abc", validNotification), builderConfig, nil)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func Test_builderHandler_should_fail_with_invalid_payload(t *testing.T) {
+	w := httptest.NewRecorder()
+	builderHandler(w, newBuilderRequest("POST", "abc123", validNotification[:20]), builderConfig, nil)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_builderHandler_should_ignore_finalized_phase(t *testing.T) {
+	body := strings.Replace(validNotification, "COMPLETED", "FINALIZED", 1)
+
+	w := httptest.NewRecorder()
+	err := builderHandler(w, newBuilderRequest("POST", "abc123", body), builderConfig, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedBody := "Ignored: FINALIZED phase."
+	if w.Body.String() != expectedBody {
+		t.Fatalf("w.Body = '%v', want %v", w.Body, expectedBody)
+	}
+}
+
+func Test_builderHandler_should_return_error_with_invalid_github_config(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := builderHandler(w, newBuilderRequest("POST", "abc123", validNotification), builderConfig, nil)
+
+	expected := "Github configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+var hubotConfig = &Config{
+	ChatDefaultRoom: "#ci",
+	Hubot: &Hubot{
+		User:     "hubot",
+		Password: "secret",
+	},
+}
+
+func newHubotRequest(command, room string) *http.Request {
+	form := url.Values{"command": {command}, "room": {room}}
+	req, _ := http.NewRequest("POST", "http://localhost:9393/_hubot", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func Test_hubotHandler_should_return_error_with_invalid_hubot_config(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := hubotHandler(w, newHubotRequest("ci", ""), &Config{}, nil)
+
+	expected := "Hubot configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+func Test_hubotHandler_should_fail_with_invalid_credentials(t *testing.T) {
+	req := newHubotRequest("ci", "")
+	req.SetBasicAuth("hubot", "wrong")
+
+	w := httptest.NewRecorder()
+	hubotHandler(w, req, hubotConfig, nil)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func Test_hubotHandler_should_reply_to_default_room(t *testing.T) {
+	req := newHubotRequest("ci", "")
+	req.SetBasicAuth("hubot", "secret")
+
+	w := httptest.NewRecorder()
+	err := hubotHandler(w, req, hubotConfig, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if w.Header().Get(hubotRoomHeader) != "#ci" {
+		t.Fatalf("w.Header().Get(hubotRoomHeader) = %v, want #ci", w.Header().Get(hubotRoomHeader))
+	}
+
+	if w.Body.String() != hubotUsage {
+		t.Fatalf("w.Body = '%v', want %v", w.Body, hubotUsage)
+	}
+}
+
+func Test_hubotHandler_should_reply_with_json_to_given_room(t *testing.T) {
+	req := newHubotRequest("ci", "#builds")
+	req.SetBasicAuth("hubot", "secret")
+	req.Header.Set("Accept", "application/json")
+
+	w := httptest.NewRecorder()
+	err := hubotHandler(w, req, hubotConfig, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	reply := &HubotReply{}
+	err = json.Unmarshal(w.Body.Bytes(), reply)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if reply.Room != "#builds" {
+		t.Fatalf("reply.Room = %v, want #builds", reply.Room)
+	}
+}
+
+func Test_setupHandler_should_return_error_with_invalid_admin_config(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost:9393/_setup", nil)
+
+	w := httptest.NewRecorder()
+	err := setupHandler(w, req, &Config{})
+
+	expected := "Admin configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+func Test_setupHandler_should_fail_with_invalid_credentials(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost:9393/_setup", nil)
+	req.SetBasicAuth("admin", "wrong")
+
+	w := httptest.NewRecorder()
+	config := &Config{Admin: &Admin{User: "admin", Password: "secret"}}
+	setupHandler(w, req, config)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func Test_githubHandler_should_reject_sha1_unless_allowed(t *testing.T) {
+	r := strings.NewReader(validPingResponse)
+	sig := hex.EncodeToString(sign([]byte(validPingResponse), "abc123"))
+
+	req, err := newGithubRequest(r, "sha1="+sig)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	req.Header.Add(githubEventType, "ping")
+
+	w := httptest.NewRecorder()
+	config := &Config{
+		Github: &Github{
+			HookSecret: "abc123",
+		},
+	}
+
+	githubHandler(w, req, config, NewStats(), newEvents())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_githubHandler_should_reject_signature_without_github_config(t *testing.T) {
+	r := strings.NewReader(validPingResponse)
+	sig := hex.EncodeToString(sign256([]byte(validPingResponse), "abc123"))
+
+	req, err := newGithubRequest(r, "sha256="+sig)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	req.Header.Add(githubEventType, "ping")
+
+	w := httptest.NewRecorder()
+	githubHandler(w, req, &Config{}, NewStats(), newEvents())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_githubHandler_should_succeed_with_sha256_signature(t *testing.T) {
+	r := strings.NewReader(validPingResponse)
+	sig := hex.EncodeToString(sign256([]byte(validPingResponse), "abc123"))
+
+	req, err := newGithubRequest(r, "sha256="+sig)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	req.Header.Add(githubEventType, "ping")
+
+	w := httptest.NewRecorder()
+	config := &Config{
+		Github: &Github{
+			HookSecret: "abc123",
+		},
+	}
+	stats := NewStats()
+
+	githubHandler(w, req, config, stats, newEvents())
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	if stats.SignatureSha256() != 1 {
+		t.Fatalf("stats.SignatureSha256() = %v, want 1", stats.SignatureSha256())
+	}
+}
+
+func Test_githubHandler_should_prefer_sha256_over_sha1(t *testing.T) {
+	r := strings.NewReader(validPingResponse)
+	sig1 := hex.EncodeToString(sign([]byte(validPingResponse), "abc123"))
+	sig256 := hex.EncodeToString(sign256([]byte(validPingResponse), "123abc"))
+
+	req, err := newGithubRequest(r, "sha1="+sig1)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	req.Header.Add(githubSignature256, "sha256="+sig256)
+	req.Header.Add(githubEventType, "ping")
+
+	w := httptest.NewRecorder()
+	config := &Config{
+		Github: &Github{
+			HookSecret: "abc123",
+			AllowSha1:  true,
+		},
+	}
+
+	githubHandler(w, req, config, NewStats(), newEvents())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func newRotationRequest(secret string) *http.Request {
+	sig := hex.EncodeToString(sign256([]byte(validPingResponse), secret))
+	req, _ := newGithubRequest(strings.NewReader(validPingResponse), "sha256="+sig)
+	req.Header.Add(githubEventType, "ping")
+	return req
+}
+
+var rotationConfig = &Config{
+	Github: &Github{
+		HookSecret: "current",
+		HookSecrets: []HookSecret{
+			{Name: "previous", Secret: "previous", Expires: time.Now().Add(time.Hour)},
+			{Name: "expired", Secret: "expired", Expires: time.Now().Add(-time.Hour)},
+		},
+	},
+}
+
+func Test_githubHandler_should_accept_previous_secret_during_rotation(t *testing.T) {
+	w := httptest.NewRecorder()
+	stats := NewStats()
+
+	githubHandler(w, newRotationRequest("previous"), rotationConfig, stats, newEvents())
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	matches := stats.SecretMatches()
+	if len(matches) != 1 || matches[0].Name != "previous" {
+		t.Fatalf("stats.SecretMatches() = %v, want [{previous 1}]", matches)
+	}
+}
+
+func Test_githubHandler_should_reject_expired_secret(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	githubHandler(w, newRotationRequest("expired"), rotationConfig, NewStats(), newEvents())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func newPushRequest(delivery string) *http.Request {
+	sig := hex.EncodeToString(sign256([]byte(validPushResponse), "abc123"))
+	req, _ := newGithubRequest(strings.NewReader(validPushResponse), "sha256="+sig)
+	req.Header.Add(githubEventType, "push")
+	req.Header.Add(githubDelivery, delivery)
+	return req
+}
+
+var pushConfig = &Config{
+	Github: &Github{
+		HookSecret: "abc123",
+	},
+}
+
+func Test_githubHandler_should_accept_valid_push(t *testing.T) {
+	stats := NewStats()
+	events := NewEventQueue(10, 0, newDeliveries(), stats, nil)
+
+	w := httptest.NewRecorder()
+	err := githubHandler(w, newPushRequest("72d3162e-cc78-11e3-81ab-4c9367dc0958"), pushConfig, stats, events)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusAccepted)
+	}
+
+	if events.Len() != 1 || stats.QueueDepth() != 1 {
+		t.Fatalf("events.Len() = %v, stats.QueueDepth() = %v, want 1", events.Len(), stats.QueueDepth())
+	}
+}
+
+func Test_githubHandler_should_fail_with_invalid_json_payload(t *testing.T) {
+	body := validPushResponse[:20]
+	sig := hex.EncodeToString(sign256([]byte(body), "abc123"))
+	req, _ := newGithubRequest(strings.NewReader(body), "sha256="+sig)
+	req.Header.Add(githubEventType, "push")
+
+	w := httptest.NewRecorder()
+	githubHandler(w, req, pushConfig, NewStats(), newEvents())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_githubHandler_should_report_duplicate_delivery(t *testing.T) {
+	events := newEvents()
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusOK} {
+		w := httptest.NewRecorder()
+		err := githubHandler(w, newPushRequest("72d3162e-cc78-11e3-81ab-4c9367dc0958"), pushConfig, NewStats(), events)
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+
+		if w.Code != expected {
+			t.Fatalf("delivery %v w.Code = %v, want %v", i, w.Code, expected)
+		}
+	}
+}
+
+func Test_githubHandler_should_fail_when_queue_is_full(t *testing.T) {
+	events := NewEventQueue(1, 0, newDeliveries(), NewStats(), nil)
+
+	for i, expected := range []int{http.StatusAccepted, http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		githubHandler(w, newPushRequest(fmt.Sprint(i)), pushConfig, NewStats(), events)
+
+		if w.Code != expected {
+			t.Fatalf("delivery %v w.Code = %v, want %v", i, w.Code, expected)
+		}
+	}
+}
+
+func Test_repositoryBuildsHandler_should_list_filtered_builds(t *testing.T) {
+	builds := openBuilds(t, filepath.Join(t.TempDir(), buildFile))
+	for _, b := range []Build{
+		{Repository: "baxterthehacker/public-repo", Branch: "master", Sha: "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c", Pusher: "baxterthehacker"},
+		{Repository: "baxterthehacker/public-repo", Branch: "feature", Sha: "9049f1265b7d61be4a8904a9a27120d2064dab3b"},
+		{Repository: "baxterthehacker/other", Branch: "master", Sha: "b9d3e6a2f8b1f0c4d8e7a6b5c4d3e2f1a0b9c8d7"},
+	} {
+		b := b
+		builds.Record(&b)
+	}
+
+	r, _ := http.NewRequest("GET", "http://localhost:9393/repositories/baxterthehacker/public-repo?branch=master", nil)
+	w := httptest.NewRecorder()
+
+	err := repositoryBuildsHandler(w, r, &Config{}, builds)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "<p>1 builds.</p>") {
+		t.Fatalf("body = %v, want to contain %v", body, "<p>1 builds.</p>")
+	}
+
+	expected := `<a href="https://github.com/baxterthehacker/public-repo/commit/0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"><code>0d1a26e</code></a>`
+	if !strings.Contains(body, expected) {
+		t.Fatalf("body = %v, want to contain %v", body, expected)
+	}
+}
+
+func Test_repositoryBuildsHandler_should_not_find_invalid_path(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost:9393/repositories/baxterthehacker", nil)
+	w := httptest.NewRecorder()
+
+	err := repositoryBuildsHandler(w, r, &Config{}, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+var jsonNegotiationTable = []struct {
+	url    string
+	accept string
+}{
+	{"http://localhost:9393/?by=date", jsonContentType},
+	{"http://localhost:9393/index.json?by=date", ""},
+}
+
+func Test_rootHandler_should_negotiate_json(t *testing.T) {
+	ts := newTrayFeedServer()
+	defer ts.Close()
+
+	config := &Config{Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"}}
+
+	for _, tt := range jsonNegotiationTable {
+		r, _ := http.NewRequest("GET", tt.url, nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+
+		err := rootHandler(w, r, config, NewRepositoryCache())
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+
+		if w.Header().Get("Content-Type") != jsonContentType {
+			t.Fatalf("%v Content-Type = %v, want %v", tt.url, w.Header().Get("Content-Type"), jsonContentType)
+		}
+
+		var p struct {
+			Order    string
+			Projects []map[string]interface{}
+		}
+		err = json.Unmarshal(w.Body.Bytes(), &p)
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+
+		if p.Order != orderByDate {
+			t.Fatalf("p.Order = %v, want %v", p.Order, orderByDate)
+		}
+
+		if len(p.Projects) == 0 || p.Projects[0]["last_build_status"] == nil {
+			t.Fatalf("p.Projects = %v, want last_build_status field", p.Projects)
+		}
+	}
+}
+
+func Test_repositoryHandler_should_render_json_with_suffix(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost:9393/repositories.json", nil)
+	w := httptest.NewRecorder()
+
+	err := repositoryHandler(w, r, &Config{Github: &Github{Token: "abc123"}}, NewRepositoryCache())
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	var list RepositoryList
+	err = json.Unmarshal(w.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if list.Order != orderByFullName {
+		t.Fatalf("list.Order = %v, want %v", list.Order, orderByFullName)
+	}
+}
+
+func Test_repositoryHandler_should_show_refresh_error(t *testing.T) {
+	var failing int32 = 1
+	ts := newReposServer(&failing)
+	defer ts.Close()
+
+	config := reposConfig(ts)
+	rc := NewRepositoryCache()
+	rc.Refresh(config)
+
+	r, _ := http.NewRequest("GET", "http://localhost:9393/repositories", nil)
+	w := httptest.NewRecorder()
+	err := repositoryHandler(w, r, config, rc)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	for _, expected := range []string{"Not loaded yet.", "Refresh failed at"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Fatalf("w.Body = %v, want to contain %v", w.Body, expected)
+		}
+	}
+}
+
+func Test_githubHandler_should_count_outcomes(t *testing.T) {
+	defer func(m *Metrics) { metrics = m }(metrics)
+	metrics = NewMetrics()
+
+	events := NewEventQueue(1, 0, newDeliveries(), NewStats(), nil)
+	for _, delivery := range []string{"a", "a", "b"} {
+		githubHandler(httptest.NewRecorder(), newPushRequest(delivery), pushConfig, NewStats(), events)
+	}
+
+	sig := hex.EncodeToString(sign256([]byte(validPingResponse), "abc123"))
+	ping, _ := newGithubRequest(strings.NewReader(validPingResponse), "sha256="+sig)
+	ping.Header.Add(githubEventType, "ping")
+	githubHandler(httptest.NewRecorder(), ping, pushConfig, NewStats(), events)
+
+	forged, _ := newGithubRequest(strings.NewReader(validPingResponse), "sha256=00")
+	forged.Header.Add(githubEventType, "ping")
+	githubHandler(httptest.NewRecorder(), forged, pushConfig, NewStats(), events)
+
+	unknown, _ := newGithubRequest(strings.NewReader(validPingResponse), "sha256=00")
+	unknown.Header.Add(githubEventType, "made-up")
+	githubHandler(httptest.NewRecorder(), unknown, pushConfig, NewStats(), events)
+
+	var b bytes.Buffer
+	metrics.WriteTo(&b)
+
+	for _, expected := range []string{
+		`lanky_webhook_events_total{type="push",outcome="duplicate"} 1`,
+		`lanky_webhook_events_total{type="push",outcome="queue_full"} 1`,
+		`lanky_webhook_events_total{type="ping",outcome="ping"} 1`,
+		`lanky_webhook_events_total{type="ping",outcome="invalid_signature"} 1`,
+		`lanky_webhook_events_total{type="other",outcome="invalid_signature"} 1`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Fatalf("metrics = %v, want to contain %v", b.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const hubotRoomHeader = "X-Hubot-Room"
+
+const hubotUsage = `Usage:
+ci build <repo>[/<branch>]
+ci status [repo]
+ci setup <repo>
+ci builds [limit]`
+
+const defaultBuildsLimit = 5
+
+type HubotReply struct {
+	Room    string `json:"room"`
+	Message string `json:"message"`
+}
+
+// HubotCommand executes a single chat command on behalf of user and returns the reply.
+func HubotCommand(command, user string, config *Config, builds BuildStore) (message string, err error) {
+	args := strings.Fields(command)
+	if len(args) < 2 || args[0] != "ci" {
+		return hubotUsage, nil
+	}
+
+	switch args[1] {
+	case "build":
+		if len(args) != 3 {
+			return hubotUsage, nil
+		}
+		return hubotBuild(args[2], user, config, builds)
+
+	case "status":
+		repo := ""
+		if len(args) > 2 {
+			repo = args[2]
+		}
+		return hubotStatus(repo, config)
+
+	case "setup":
+		if len(args) != 3 {
+			return hubotUsage, nil
+		}
+		return hubotSetup(args[2], config)
+
+	case "builds":
+		limit := defaultBuildsLimit
+		if len(args) > 2 {
+			limit, err = strconv.Atoi(args[2])
+			if err != nil || limit < 1 {
+				return hubotUsage, nil
+			}
+		}
+		return hubotBuilds(limit, config)
+	}
+
+	return hubotUsage, nil
+}
+
+func hubotBuild(target, user string, config *Config, builds BuildStore) (message string, err error) {
+	cl := NewGithub(config)
+	if cl == nil {
+		return "", errors.New("Github configuration is invalid.")
+	}
+
+	j := NewJenkins(config)
+	if j == nil {
+		return "", errors.New("Jenkins configuration is invalid.")
+	}
+
+	name, branch := target, ""
+	if i := strings.Index(target, "/"); i != -1 {
+		name, branch = target[:i], target[i+1:]
+	}
+
+	repo := &Repository{}
+	err = cl.GetRepository(config.Github.Organization+"/"+name, repo)
+	if err != nil {
+		return "", err
+	}
+
+	if branch == "" {
+		branch = repo.DefaultBranch
+	}
+
+	build := &BuildRequest{
+		Job:        repo.JobName(),
+		Branch:     branch,
+		Repository: repo.FullName,
+		Pusher:     user,
+	}
+
+	location, err := j.TriggerBuild(build)
+	if err != nil {
+		return "", err
+	}
+	recordBuild(builds, build, location)
+
+	return fmt.Sprintf("Build of %v/%v queued at %v", name, branch, location), nil
+}
+
+func hubotSetup(name string, config *Config) (message string, err error) {
+	results, err := SetupRepositories(config, []string{name})
+	if err != nil {
+		return "", err
+	}
+
+	return results[0].String(), nil
+}
+
+func hubotStatus(repo string, config *Config) (message string, err error) {
+	p, err := hubotProjects(config)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, p.Len())
+	for i := range p.Project {
+		if repo != "" && !isRepositoryJob(p.Project[i].Name, repo) {
+			continue
+		}
+		lines = append(lines, formatProject(&p.Project[i]))
+	}
+
+	if len(lines) == 0 {
+		return fmt.Sprintf("No builds found for %v.", repo), nil
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// isRepositoryJob reports whether name is the job of repo, named
+// {repo}-{id} as by Repository.JobName.
+func isRepositoryJob(name, repo string) bool {
+	id := strings.TrimPrefix(name, repo+"-")
+	if id == name || id == "" {
+		return false
+	}
+
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hubotBuilds(limit int, config *Config) (message string, err error) {
+	p, err := hubotProjects(config)
+	if err != nil {
+		return "", err
+	}
+
+	if limit > p.Len() {
+		limit = p.Len()
+	}
+
+	lines := make([]string, 0, limit)
+	for i := 0; i < limit; i++ {
+		lines = append(lines, formatProject(&p.Project[i]))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func hubotProjects(config *Config) (p *Projects, err error) {
+	j := NewJenkins(config)
+	if j == nil {
+		return nil, errors.New("Jenkins configuration is invalid.")
+	}
+
+	p = &Projects{}
+	err = j.TrayFeed(p, orderByDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func formatProject(p *Project) string {
+	return fmt.Sprintf("%v #%v %v at %v - %v", p.Name, p.LastBuildLabel, p.LastBuildStatus, p.BuildTime(), p.ConsoleUrl())
+}
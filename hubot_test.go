@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTrayFeedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(validTrayFeed))
+	}))
+}
+
+var usageTable = []string{
+	"",
+	"ci",
+	"deploy build lanky",
+	"ci build",
+	"ci setup",
+	"ci builds none",
+	"ci builds 0",
+	"ci unknown",
+}
+
+func Test_HubotCommand_should_return_usage_for_invalid_commands(t *testing.T) {
+	for _, command := range usageTable {
+		message, err := HubotCommand(command, "hubot", &Config{}, nil)
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+
+		if message != hubotUsage {
+			t.Fatalf("HubotCommand(%q) = %v, want usage", command, message)
+		}
+	}
+}
+
+func Test_HubotCommand_build_should_return_error_with_invalid_github_config(t *testing.T) {
+	_, err := HubotCommand("ci build lanky/master", "hubot", &Config{}, nil)
+
+	expected := "Github configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+func Test_HubotCommand_builds_should_return_limited_builds(t *testing.T) {
+	ts := newTrayFeedServer()
+	defer ts.Close()
+
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"},
+	}
+
+	message, err := HubotCommand("ci builds 2", "hubot", config, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	lines := strings.Split(message, "\n")
+	expectedLen := 2
+	if len(lines) != expectedLen {
+		t.Fatalf("len(lines) = %v, want %v", len(lines), expectedLen)
+	}
+
+	expectedPrefix := "infra_backend-merge-all-repo #162 Success"
+	if !strings.HasPrefix(lines[0], expectedPrefix) {
+		t.Fatalf("lines[0] = %v, want prefix %v", lines[0], expectedPrefix)
+	}
+}
+
+const repositoryTrayFeed = `<Projects><Project webUrl="http://jenkins.local/job/api-123/" name="api-123" lastBuildLabel="7" lastBuildTime="2015-05-29T03:23:00Z" lastBuildStatus="Failure" activity="Sleeping"/><Project webUrl="http://jenkins.local/job/api-gateway-456/" name="api-gateway-456" lastBuildLabel="9" lastBuildTime="2015-05-29T03:23:00Z" lastBuildStatus="Success" activity="Sleeping"/></Projects>`
+
+func Test_HubotCommand_status_should_filter_by_repository(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(repositoryTrayFeed))
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"},
+	}
+
+	message, err := HubotCommand("ci status api", "hubot", config, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedPrefix := "api-123 #7 Failure"
+	if !strings.HasPrefix(message, expectedPrefix) || strings.Contains(message, "\n") {
+		t.Fatalf("message = %v, want single line with prefix %v", message, expectedPrefix)
+	}
+
+	message, err = HubotCommand("ci status lanky", "hubot", config, nil)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expected := "No builds found for lanky."
+	if message != expected {
+		t.Fatalf("message = %v, want %v", message, expected)
+	}
+}
+
+var repositoryJobTable = []struct {
+	name     string
+	repo     string
+	expected bool
+}{
+	{"api-123", "api", true},
+	{"api-gateway-456", "api", false},
+	{"api-gateway-456", "api-gateway", true},
+	{"api-", "api", false},
+	{"api", "api", false},
+	{"api-12a", "api", false},
+}
+
+func Test_isRepositoryJob_should_match_name_and_id(t *testing.T) {
+	for _, tt := range repositoryJobTable {
+		if actual := isRepositoryJob(tt.name, tt.repo); actual != tt.expected {
+			t.Fatalf("isRepositoryJob(%v, %v) = %v, want %v", tt.name, tt.repo, actual, tt.expected)
+		}
+	}
+}
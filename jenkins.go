@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,6 +28,16 @@ func NewJenkins(config *Config) (client *JenkinsClient) {
 		Timeout: config.ClientTimeout(),
 	}
 
+	var rt http.RoundTripper = http.DefaultTransport
+	if config.Jenkins.User != "" {
+		rt = &basicAuthTransport{
+			config.Jenkins.User,
+			config.Jenkins.Token,
+			rt,
+		}
+	}
+	wc.Transport = &instrumentedTransport{"jenkins", rt}
+
 	return &JenkinsClient{
 		config,
 		wc,
@@ -33,6 +47,7 @@ func NewJenkins(config *Config) (client *JenkinsClient) {
 type WebClient interface {
 	Get(url string) (resp *http.Response, err error)
 	Post(url string, bodyType string, body io.Reader) (resp *http.Response, err error)
+	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 type JenkinsClient struct {
@@ -40,6 +55,44 @@ type JenkinsClient struct {
 	WebClient
 }
 
+// basicAuthTransport adds the Jenkins user and API token to every request.
+type basicAuthTransport struct {
+	user  string
+	token string
+	http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.SetBasicAuth(t.user, t.token)
+	return t.RoundTripper.RoundTrip(r)
+}
+
+type JobNotFoundError struct {
+	Job string
+}
+
+func (e *JobNotFoundError) Error() string {
+	return fmt.Sprintf("Jenkins job %v does not exist.", e.Job)
+}
+
+type JenkinsAuthError struct {
+	Status string
+}
+
+func (e *JenkinsAuthError) Error() string {
+	return fmt.Sprintf("Jenkins authentication failed with %v.", e.Status)
+}
+
+type JenkinsUnreachableError struct {
+	Err     error
+	Timeout time.Duration
+}
+
+func (e *JenkinsUnreachableError) Error() string {
+	return fmt.Sprintf("Jenkins is unreachable: %v with a timeout of %v", e.Err.Error(), e.Timeout)
+}
+
 func (j *JenkinsClient) TrayFeed(p *Projects, by string) (err error) {
 	trayFeedUrl := j.Config.TrayFeedUrl()
 
@@ -71,17 +124,105 @@ func (j *JenkinsClient) TrayFeed(p *Projects, by string) (err error) {
 	return nil
 }
 
-func (j *JenkinsClient) TriggerBuild() (err error) {
-	return nil
+// JobExists reports whether the named job is already configured in Jenkins.
+func (j *JenkinsClient) JobExists(job string) (exists bool, err error) {
+	resp, err := j.WebClient.Get(j.JobUrl(job) + "/api/json")
+	if err != nil {
+		return false, &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false, &JenkinsAuthError{resp.Status}
+	}
+
+	return false, fmt.Errorf("Unexpected response %v for job %v.", resp.Status, job)
+}
+
+const xmlContentType = "application/xml"
+
+// CreateJob creates a new Jenkins job from the supplied config.xml.
+func (j *JenkinsClient) CreateJob(job string, configXml io.Reader) (err error) {
+	createUrl := strings.TrimRight(j.Config.Jenkins.BaseUrl, "/") + "/createItem?name=" + url.QueryEscape(job)
+
+	resp, err := j.WebClient.Post(createUrl, xmlContentType, configXml)
+	if err != nil {
+		return &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &JenkinsAuthError{resp.Status}
+	}
+
+	return fmt.Errorf("Unexpected response %v creating job %v.", resp.Status, job)
+}
+
+// BuildRequest describes a single commit to be built by Jenkins.
+type BuildRequest struct {
+	Job         string
+	Sha         string
+	Branch      string
+	Repository  string
+	Pusher      string
+	PullRequest int
+	BaseBranch  string
+}
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// JobUrl is the base URL of the named Jenkins job.
+func (j *JenkinsClient) JobUrl(job string) string {
+	return strings.TrimRight(j.Config.Jenkins.BaseUrl, "/") + "/job/" + url.PathEscape(job)
+}
+
+// TriggerBuild queues a parameterised build and returns the Jenkins queue item URL.
+func (j *JenkinsClient) TriggerBuild(build *BuildRequest) (location string, err error) {
+	params := url.Values{}
+	params.Set("SHA", build.Sha)
+	params.Set("BRANCH", build.Branch)
+	params.Set("REPOSITORY", build.Repository)
+	params.Set("PUSHER", build.Pusher)
+	params.Set("CALLBACK_URL", j.Config.BuilderUrl())
+	if build.PullRequest > 0 {
+		params.Set("PR_NUMBER", strconv.Itoa(build.PullRequest))
+		params.Set("BASE_BRANCH", build.BaseBranch)
+	}
+
+	buildUrl := j.JobUrl(build.Job) + "/buildWithParameters"
+	resp, err := j.WebClient.Post(buildUrl, formContentType, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return resp.Header.Get("Location"), nil
+	case http.StatusNotFound:
+		return "", &JobNotFoundError{build.Job}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", &JenkinsAuthError{resp.Status}
+	}
+
+	return "", fmt.Errorf("Unexpected response %v from %v.", resp.Status, buildUrl)
 }
 
 type Project struct {
-	WebUrl          string    `xml:"webUrl,attr"`
-	Name            string    `xml:"name,attr"`
-	LastBuildLabel  string    `xml:"lastBuildLabel,attr"`
-	LastBuildTime   time.Time `xml:"lastBuildTime,attr"`
-	LastBuildStatus string    `xml:"lastBuildStatus,attr"`
-	Activity        string    `xml:"activity,attr"`
+	WebUrl          string    `xml:"webUrl,attr" json:"web_url"`
+	Name            string    `xml:"name,attr" json:"name"`
+	LastBuildLabel  string    `xml:"lastBuildLabel,attr" json:"last_build_label"`
+	LastBuildTime   time.Time `xml:"lastBuildTime,attr" json:"last_build_time"`
+	LastBuildStatus string    `xml:"lastBuildStatus,attr" json:"last_build_status"`
+	Activity        string    `xml:"activity,attr" json:"activity"`
 }
 
 func (p *Project) BuildTime() string {
@@ -93,15 +234,30 @@ func (p *Project) ConsoleUrl() string {
 }
 
 type Projects struct {
-	XMLName xml.Name `xml:"Projects"`
-	Project []Project
-	Order   string
+	XMLName xml.Name  `xml:"Projects" json:"-"`
+	Project []Project `json:"projects"`
+	Order   string    `json:"order"`
 }
 
 func (p *Projects) ByDate() bool  { return p.Order == orderByDate }
 func (p *Projects) Len() int      { return len(p.Project) }
 func (p *Projects) Swap(i, j int) { p.Project[i], p.Project[j] = p.Project[j], p.Project[i] }
 
+// Hide removes the named projects.
+func (p *Projects) Hide(names map[string]bool) {
+	if len(names) == 0 {
+		return
+	}
+
+	visible := p.Project[:0]
+	for _, project := range p.Project {
+		if !names[project.Name] {
+			visible = append(visible, project)
+		}
+	}
+	p.Project = visible
+}
+
 type ByStatus struct{ *Projects }
 
 func (p ByStatus) Less(i, j int) bool {
@@ -120,3 +276,233 @@ func ReadTrayFeed(r io.Reader, p *Projects) error {
 
 	return err
 }
+
+// Actions are the Jenkins actions attached to a queue item or build.
+type Actions []struct {
+	Parameters []struct {
+		Name  string
+		Value interface{}
+	}
+}
+
+// Parameter returns the named build parameter or an empty string.
+func (a Actions) Parameter(name string) string {
+	for _, action := range a {
+		for _, p := range action.Parameters {
+			if p.Name == name {
+				return fmt.Sprint(p.Value)
+			}
+		}
+	}
+	return ""
+}
+
+type QueueItem struct {
+	Id   int
+	Task struct {
+		Name string
+	}
+	Actions Actions
+}
+
+type Queue struct {
+	Items []QueueItem
+}
+
+// CancelQueued removes builds of the pull request that are still waiting in the Jenkins queue.
+func (j *JenkinsClient) CancelQueued(job string, pullRequest int) (cancelled int, err error) {
+	baseUrl := strings.TrimRight(j.Config.Jenkins.BaseUrl, "/")
+	queueUrl := baseUrl + "/queue/api/json?tree=items[id,task[name],actions[parameters[name,value]]]"
+
+	resp, err := j.WebClient.Get(queueUrl)
+	if err != nil {
+		return 0, &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+	}
+
+	q := &Queue{}
+	dec := json.NewDecoder(resp.Body)
+	err = dec.Decode(q)
+	resp.Body.Close()
+	if err != nil {
+		return 0, errors.New(err.Error() + " from " + queueUrl)
+	}
+
+	number := strconv.Itoa(pullRequest)
+	for i := range q.Items {
+		item := &q.Items[i]
+		if item.Task.Name != job || item.Actions.Parameter("PR_NUMBER") != number {
+			continue
+		}
+
+		cancelUrl := fmt.Sprintf("%v/queue/cancelItem?id=%v", baseUrl, item.Id)
+		resp, err := j.WebClient.Post(cancelUrl, formContentType, strings.NewReader(""))
+		if err != nil {
+			return cancelled, &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+			return cancelled, fmt.Errorf("Unexpected response %v cancelling queue item %v.", resp.Status, item.Id)
+		}
+		cancelled++
+	}
+
+	return cancelled, nil
+}
+
+type JobBuild struct {
+	Number    int
+	Result    string
+	Building  bool
+	Timestamp int64
+	Duration  int64
+	Url       string
+	Actions   Actions
+}
+
+// Status maps the Jenkins build result onto the commit status states.
+func (jb *JobBuild) Status() string {
+	if jb.Building {
+		return statePending
+	}
+
+	switch jb.Result {
+	case buildSuccess:
+		return stateSuccess
+	case buildFailure, buildUnstable:
+		return stateFailure
+	}
+	return stateError
+}
+
+// Build converts the Jenkins build into a build history record.
+func (jb *JobBuild) Build(job string) Build {
+	started := time.Unix(0, jb.Timestamp*int64(time.Millisecond))
+	b := Build{
+		Job:        job,
+		Repository: jb.Actions.Parameter("REPOSITORY"),
+		Branch:     jb.Actions.Parameter("BRANCH"),
+		Sha:        jb.Actions.Parameter("SHA"),
+		Pusher:     jb.Actions.Parameter("PUSHER"),
+		Number:     jb.Number,
+		Status:     jb.Status(),
+		ConsoleUrl: jb.Url + "console",
+		QueuedAt:   started,
+		StartedAt:  started,
+	}
+
+	if !jb.Building {
+		b.FinishedAt = started.Add(time.Duration(jb.Duration) * time.Millisecond)
+	}
+
+	return b
+}
+
+// JobBuilds returns up to limit of the most recent builds of the job from the Jenkins API.
+func (j *JenkinsClient) JobBuilds(job string, limit int) (builds []Build, err error) {
+	buildsUrl := fmt.Sprintf("%v/api/json?tree=builds[number,result,building,timestamp,duration,url,actions[parameters[name,value]]]{0,%v}", j.JobUrl(job), limit)
+
+	resp, err := j.WebClient.Get(buildsUrl)
+	if err != nil {
+		return nil, &JenkinsUnreachableError{err, j.Config.ClientTimeout()}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, &JobNotFoundError{job}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, &JenkinsAuthError{resp.Status}
+	}
+
+	jobBuilds := &struct{ Builds []JobBuild }{}
+	dec := json.NewDecoder(resp.Body)
+	err = dec.Decode(jobBuilds)
+	if err != nil {
+		return nil, errors.New(err.Error() + " from " + buildsUrl)
+	}
+
+	builds = make([]Build, 0, len(jobBuilds.Builds))
+	for i := range jobBuilds.Builds {
+		builds = append(builds, jobBuilds.Builds[i].Build(job))
+	}
+
+	return builds, nil
+}
+
+const (
+	phaseQueued    = "QUEUED"
+	phaseStarted   = "STARTED"
+	phaseCompleted = "COMPLETED"
+
+	buildSuccess  = "SUCCESS"
+	buildFailure  = "FAILURE"
+	buildUnstable = "UNSTABLE"
+)
+
+// JenkinsNotification is the payload posted by the Jenkins notification plugin.
+type JenkinsNotification struct {
+	Name  string
+	Url   string
+	Build struct {
+		FullUrl string `json:"full_url"`
+		Number  int
+		Phase   string
+		Status  string
+		Url     string
+		Scm     struct {
+			Url    string
+			Branch string
+			Commit string
+		}
+		Parameters map[string]string
+	}
+}
+
+// Sha is the commit under test, preferring the parameter Lanky supplied.
+func (n *JenkinsNotification) Sha() string {
+	if sha := n.Build.Parameters["SHA"]; sha != "" {
+		return sha
+	}
+	return n.Build.Scm.Commit
+}
+
+// Repository is the full name of the GitHub repository being built.
+func (n *JenkinsNotification) Repository() string {
+	return n.Build.Parameters["REPOSITORY"]
+}
+
+func (n *JenkinsNotification) ConsoleUrl() string {
+	return n.Build.FullUrl + "console"
+}
+
+// CommitStatus maps the build phase and status onto a GitHub commit status.
+// An empty status is returned for phases that should not be reported.
+func (n *JenkinsNotification) CommitStatus() *CommitStatus {
+	cs := &CommitStatus{
+		TargetUrl: Url(n.ConsoleUrl()),
+		Context:   commitStatusContext,
+	}
+
+	switch n.Build.Phase {
+	case phaseQueued, phaseStarted:
+		cs.State = statePending
+		cs.Description = fmt.Sprintf("Build #%v started.", n.Build.Number)
+	case phaseCompleted:
+		switch n.Build.Status {
+		case buildSuccess:
+			cs.State = stateSuccess
+			cs.Description = fmt.Sprintf("Build #%v succeeded.", n.Build.Number)
+		case buildFailure, buildUnstable:
+			cs.State = stateFailure
+			cs.Description = fmt.Sprintf("Build #%v failed.", n.Build.Number)
+		default:
+			cs.State = stateError
+			cs.Description = fmt.Sprintf("Build #%v finished with %v.", n.Build.Number, n.Build.Status)
+		}
+	default:
+		return nil
+	}
+
+	return cs
+}
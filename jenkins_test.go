@@ -1,6 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -173,3 +178,310 @@ func Test_TrayFeed_with_valid_xml_should_populate_projects(t *testing.T) {
 		}
 	}
 }
+
+func newTriggerClient(status int) (*JenkinsClient, *TestClient) {
+	c := &Config{
+		BaseUrl: "http://lanky.local/",
+		Jenkins: &Jenkins{
+			BaseUrl:  "http://ci.local",
+			TrayFeed: "/cc.xml",
+		},
+	}
+	tc := newClient()
+	tc.status = status
+	tc.header = http.Header{"Location": []string{"http://ci.local/queue/item/42/"}}
+
+	return &JenkinsClient{c, tc}, tc
+}
+
+var validBuild = &BuildRequest{
+	Job:        "releases-web-28084179",
+	Sha:        "ebe220cce16e1d9ff50b7bf0de5033ff89c4ed81",
+	Branch:     "master",
+	Repository: "hailocab/releases-web",
+	Pusher:     "nfisher",
+}
+
+func Test_TriggerBuild_should_post_parameters_and_return_queue_location(t *testing.T) {
+	j, tc := newTriggerClient(http.StatusCreated)
+
+	location, err := j.TriggerBuild(validBuild)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedLocation := "http://ci.local/queue/item/42/"
+	if location != expectedLocation {
+		t.Fatalf("location = %v, want %v", location, expectedLocation)
+	}
+
+	expectedUrl := "http://ci.local/job/releases-web-28084179/buildWithParameters"
+	if tc.urls[0] != expectedUrl {
+		t.Fatalf("tc.urls[0] = %v, want %v", tc.urls[0], expectedUrl)
+	}
+
+	params, err := url.ParseQuery(tc.bodies[0])
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedCallback := "http://lanky.local/_builder"
+	if params.Get("CALLBACK_URL") != expectedCallback {
+		t.Fatalf("CALLBACK_URL = %v, want %v", params.Get("CALLBACK_URL"), expectedCallback)
+	}
+
+	if params.Get("SHA") != validBuild.Sha {
+		t.Fatalf("SHA = %v, want %v", params.Get("SHA"), validBuild.Sha)
+	}
+}
+
+func Test_TriggerBuild_with_connection_error_should_return_unreachable(t *testing.T) {
+	j, _ := newTriggerClient(0)
+
+	_, err := j.TriggerBuild(validBuild)
+	if _, ok := err.(*JenkinsUnreachableError); !ok {
+		t.Fatalf("err = %#v, want *JenkinsUnreachableError", err)
+	}
+}
+
+var triggerErrors = []struct {
+	status   int
+	expected string
+}{
+	{http.StatusNotFound, "*main.JobNotFoundError"},
+	{http.StatusUnauthorized, "*main.JenkinsAuthError"},
+	{http.StatusForbidden, "*main.JenkinsAuthError"},
+	{http.StatusInternalServerError, "*errors.errorString"},
+}
+
+func Test_TriggerBuild_should_return_typed_errors(t *testing.T) {
+	for _, tt := range triggerErrors {
+		j, _ := newTriggerClient(tt.status)
+
+		_, err := j.TriggerBuild(validBuild)
+		actual := fmt.Sprintf("%T", err)
+		if actual != tt.expected {
+			t.Fatalf("TriggerBuild() with %v = %v, want %v", tt.status, actual, tt.expected)
+		}
+	}
+}
+
+const validNotification = `{
+  "name": "releases-web-28084179",
+  "url": "job/releases-web-28084179/",
+  "build": {
+    "full_url": "http://ci.local/job/releases-web-28084179/18/",
+    "number": 18,
+    "phase": "COMPLETED",
+    "status": "SUCCESS",
+    "url": "job/releases-web-28084179/18/",
+    "scm": {
+      "url": "git@github.com:hailocab/releases-web.git",
+      "branch": "origin/master",
+      "commit": "98631d4912c3e4dbad586ea01a00274d364e0745"
+    },
+    "parameters": {
+      "SHA": "ebe220cce16e1d9ff50b7bf0de5033ff89c4ed81",
+      "REPOSITORY": "hailocab/releases-web"
+    }
+  }
+}`
+
+func Test_should_process_valid_notification_correctly(t *testing.T) {
+	n := &JenkinsNotification{}
+	err := json.Unmarshal([]byte(validNotification), n)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	expectedSha := "ebe220cce16e1d9ff50b7bf0de5033ff89c4ed81"
+	if n.Sha() != expectedSha {
+		t.Fatalf("n.Sha() = %v, want %v", n.Sha(), expectedSha)
+	}
+
+	expectedRepo := "hailocab/releases-web"
+	if n.Repository() != expectedRepo {
+		t.Fatalf("n.Repository() = %v, want %v", n.Repository(), expectedRepo)
+	}
+
+	expectedConsole := "http://ci.local/job/releases-web-28084179/18/console"
+	if n.ConsoleUrl() != expectedConsole {
+		t.Fatalf("n.ConsoleUrl() = %v, want %v", n.ConsoleUrl(), expectedConsole)
+	}
+}
+
+func Test_Sha_should_fall_back_to_scm_commit(t *testing.T) {
+	n := &JenkinsNotification{}
+	n.Build.Scm.Commit = "98631d4912c3e4dbad586ea01a00274d364e0745"
+
+	if n.Sha() != n.Build.Scm.Commit {
+		t.Fatalf("n.Sha() = %v, want %v", n.Sha(), n.Build.Scm.Commit)
+	}
+}
+
+var commitStatusTable = []struct {
+	phase    string
+	status   string
+	expected string
+}{
+	{"QUEUED", "", "pending"},
+	{"STARTED", "", "pending"},
+	{"COMPLETED", "SUCCESS", "success"},
+	{"COMPLETED", "FAILURE", "failure"},
+	{"COMPLETED", "UNSTABLE", "failure"},
+	{"COMPLETED", "ABORTED", "error"},
+}
+
+func Test_CommitStatus(t *testing.T) {
+	for _, tt := range commitStatusTable {
+		n := &JenkinsNotification{}
+		n.Build.Phase = tt.phase
+		n.Build.Status = tt.status
+
+		cs := n.CommitStatus()
+		if cs.State != tt.expected {
+			t.Fatalf("CommitStatus() for %v/%v = %v, want %v", tt.phase, tt.status, cs.State, tt.expected)
+		}
+	}
+}
+
+func Test_CommitStatus_should_ignore_finalized_phase(t *testing.T) {
+	n := &JenkinsNotification{}
+	n.Build.Phase = "FINALIZED"
+
+	if cs := n.CommitStatus(); cs != nil {
+		t.Fatalf("n.CommitStatus() = %v, want nil", cs)
+	}
+}
+
+const validQueue = `{"items":[
+  {"id":7,"task":{"name":"public-repo-35129377"},"actions":[{"parameters":[{"name":"PR_NUMBER","value":"1"}]}]},
+  {"id":8,"task":{"name":"public-repo-35129377"},"actions":[{},{"parameters":[{"name":"PR_NUMBER","value":"2"}]}]},
+  {"id":9,"task":{"name":"other-1"},"actions":[{"parameters":[{"name":"PR_NUMBER","value":"1"}]}]}
+]}`
+
+func newQueueServer(cancelled *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/queue/api/json":
+			w.Write([]byte(validQueue))
+		case "/queue/cancelItem":
+			*cancelled = append(*cancelled, r.URL.Query().Get("id"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func Test_CancelQueued_should_cancel_matching_pull_request(t *testing.T) {
+	var cancelled []string
+	ts := newQueueServer(&cancelled)
+	defer ts.Close()
+
+	j := NewJenkins(&Config{Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"}})
+
+	n, err := j.CancelQueued("public-repo-35129377", 1)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if n != 1 || len(cancelled) != 1 || cancelled[0] != "7" {
+		t.Fatalf("cancelled = %v (%v), want [7]", cancelled, n)
+	}
+}
+
+func Test_TriggerBuild_should_include_pull_request_parameters(t *testing.T) {
+	j, tc := newTriggerClient(http.StatusCreated)
+
+	build := &BuildRequest{
+		Job:         "public-repo-35129377",
+		Sha:         "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+		Branch:      "pull/1/head",
+		PullRequest: 1,
+		BaseBranch:  "master",
+	}
+
+	_, err := j.TriggerBuild(build)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	params, _ := url.ParseQuery(tc.bodies[0])
+	if params.Get("PR_NUMBER") != "1" || params.Get("BASE_BRANCH") != "master" {
+		t.Fatalf("params = %v, want PR_NUMBER=1 and BASE_BRANCH=master", params)
+	}
+}
+
+const validJobBuilds = `{"builds":[
+  {"number":3,"building":true,"timestamp":1400000000000,"duration":0,"url":"http://ci.local/job/public-repo-35129377/3/","actions":[{"parameters":[{"name":"SHA","value":"0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c"},{"name":"BRANCH","value":"master"}]}]},
+  {"number":2,"result":"FAILURE","building":false,"timestamp":1400000000000,"duration":90000,"url":"http://ci.local/job/public-repo-35129377/2/","actions":[{},{"parameters":[{"name":"BRANCH","value":"feature"},{"name":"PUSHER","value":"baxterthehacker"}]}]}
+]}`
+
+func Test_JobBuilds_should_map_jenkins_builds(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/job/public-repo-35129377/api/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(validJobBuilds))
+	}))
+	defer ts.Close()
+
+	j := NewJenkins(&Config{Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"}})
+
+	builds, err := j.JobBuilds("public-repo-35129377", 10)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if len(builds) != 2 {
+		t.Fatalf("len(builds) = %v, want %v", len(builds), 2)
+	}
+
+	if builds[0].Status != statePending {
+		t.Fatalf("builds[0].Status = %v, want %v", builds[0].Status, statePending)
+	}
+
+	if builds[0].ShortSha() != "0d1a26e" {
+		t.Fatalf("builds[0].ShortSha() = %v, want %v", builds[0].ShortSha(), "0d1a26e")
+	}
+
+	if builds[1].Status != stateFailure {
+		t.Fatalf("builds[1].Status = %v, want %v", builds[1].Status, stateFailure)
+	}
+
+	if builds[1].Duration() != 90*time.Second {
+		t.Fatalf("builds[1].Duration() = %v, want %v", builds[1].Duration(), 90*time.Second)
+	}
+
+	if builds[1].Pusher != "baxterthehacker" {
+		t.Fatalf("builds[1].Pusher = %v, want %v", builds[1].Pusher, "baxterthehacker")
+	}
+
+	expectedUrl := "http://ci.local/job/public-repo-35129377/2/console"
+	if builds[1].ConsoleUrl != expectedUrl {
+		t.Fatalf("builds[1].ConsoleUrl = %v, want %v", builds[1].ConsoleUrl, expectedUrl)
+	}
+}
+
+func Test_JobBuilds_should_return_job_not_found(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	j := NewJenkins(&Config{Jenkins: &Jenkins{BaseUrl: ts.URL, TrayFeed: "/cc.xml"}})
+
+	_, err := j.JobBuilds("missing-1", 10)
+	if _, ok := err.(*JobNotFoundError); !ok {
+		t.Fatalf("err = %v, want *JobNotFoundError", err)
+	}
+}
+
+func Test_Projects_Hide_should_remove_named_projects(t *testing.T) {
+	p := &Projects{Project: []Project{{Name: "public-repo-1"}, {Name: "private-repo-2"}, {Name: "lanky-3"}}}
+	p.Hide(map[string]bool{"private-repo-2": true})
+
+	if p.Len() != 2 || p.Project[0].Name != "public-repo-1" || p.Project[1].Name != "lanky-3" {
+		t.Fatalf("p.Project = %v, want public-repo-1 and lanky-3", p.Project)
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/golang/glog"
 )
@@ -14,28 +17,160 @@ func main() {
 	var configPath string
 
 	flag.StringVar(&configPath, "config", defaultConfigPath, "path to lanky configuration file (default "+defaultConfigPath+")")
+	flag.Usage = usage
 	flag.Parse()
 
-	r, err := os.Open(configPath)
+	config, err := ReadConfig(configPath, os.LookupEnv)
 	if err != nil {
-		glog.Fatalf("Unable to open config file %v: %v", configPath, err)
+		glog.Fatalf("Error reading config file %v: %v", configPath, err)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+		break
+	case "setup":
+		os.Exit(setup(config, flag.Args()[1:]))
+	case "reconcile":
+		os.Exit(reconcile(config))
+	default:
+		usage()
+		os.Exit(2)
 	}
 
-	config := &Config{}
-	err = LoadConfig(r, config)
+	configs := NewConfigStore(configPath, os.LookupEnv, config)
+	go reloadOnSignal(configs)
+
+	stop := make(chan struct{})
+	interval, err := config.ReconcileInterval()
 	if err != nil {
-		glog.Fatalf("Error reading config file %v: %v", configPath, err)
+		glog.Fatalf("Invalid github reconcileInterval: %v", err)
+	}
+	if interval > 0 {
+		go ReconcileHooksEvery(configs, interval, stop)
+	}
+
+	repos := NewRepositoryCache()
+	go repos.RefreshEvery(configs, stop)
+
+	deliveries, err := NewDeliveryStore(config)
+	if err != nil {
+		glog.Fatalf("Unable to open delivery store: %v", err)
+	}
+
+	builds, err := NewBuildStore(config)
+	if err != nil {
+		glog.Fatalf("Unable to open build store: %v", err)
+	}
+
+	err = templates.Configure(config.TemplatesDir, config.TemplatesReload)
+	if err != nil {
+		glog.Fatalf("Unable to load templates: %v", err)
 	}
 
 	stats := NewStats()
 
-	RegisterRoutes(config, stats)
+	events := NewEventQueue(config.EventQueueSize(), config.WorkerCount(), deliveries, stats, func(e *Event) (string, error) {
+		return ProcessEvent(configs.Config(), builds, e)
+	})
+	ready := &Readiness{}
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, configs, stats, events, builds, repos, ready)
+
+	srv, err := NewServer(config, &LoggingHandler{mux, stats})
+	if err != nil {
+		glog.Fatalf("Invalid server configuration: %v", err)
+	}
+	servers := []*http.Server{srv}
+
+	// every route is registered before serving so no request reaches a
+	// partially built mux.
+	var adminSrv *http.Server
+	if config.Admin != nil && config.Admin.Address != "" {
+		adminMux := http.NewServeMux()
+		RegisterOperationalRoutes(adminMux, configs, stats, false)
+
+		adminSrv, err = NewAdminServer(config, &LoggingHandler{adminMux, stats})
+		if err != nil {
+			glog.Fatalf("Invalid server configuration: %v", err)
+		}
+		servers = append(servers, adminSrv)
+	} else {
+		RegisterOperationalRoutes(mux, configs, stats, true)
+	}
 
-	handler := &LoggingHandler{http.DefaultServeMux, stats}
-	address := config.Address
-	cert := config.CertificatePath
-	key := config.KeyPath
+	served := make(chan error, len(servers))
+	go func() {
+		glog.Warningf("Starting server listening at %v.", config.Address)
+		served <- Serve(srv, config.CertificatePath, config.KeyPath)
+	}()
+
+	if adminSrv != nil {
+		go func() {
+			glog.Warningf("Starting admin server listening at %v.", adminSrv.Addr)
+			served <- Serve(adminSrv, "", "")
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-served:
+		glog.Fatal(err)
+	case s := <-sig:
+		glog.Warningf("Received %v, draining requests and %v queued events.", s, events.Len())
+		err = shutdown(configs.Config(), servers, events, ready, stop)
+		if err != nil {
+			glog.Error(err.Error())
+			glog.Flush()
+			os.Exit(1)
+		}
+	}
+
+	glog.Flush()
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  setup [repo...]  create Jenkins jobs for organization repositories")
+	fmt.Fprintln(os.Stderr, "  reconcile        install or repair the webhook on organization repositories")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func setup(config *Config, names []string) int {
+	results, err := SetupRepositories(config, names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setup failed: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, result := range results {
+		fmt.Println(result)
+		if result.Err != nil {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func reconcile(config *Config) int {
+	drift, err := ReconcileHooks(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Reconcile failed: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, hd := range drift {
+		fmt.Println(hd)
+		if hd.Err != nil {
+			status = 1
+		}
+	}
 
-	glog.Warningf("Starting server listening at %v.", config.Address)
-	glog.Fatal(ListenAndServe(address, cert, key, handler))
+	return status
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics is the process wide registry exposed on /metrics. Like expvar it is
+// package level so that clients created from the config can be instrumented.
+var metrics = NewMetrics()
+
+type Histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+
+	s := d.Seconds()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// Metrics are the request, event and client counters in Prometheus form.
+type Metrics struct {
+	sync.Mutex
+	requests       map[string]uint64
+	requestLatency map[string]*Histogram
+	events         map[string]uint64
+	clientLatency  map[string]*Histogram
+	clientErrors   map[string]uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:       make(map[string]uint64),
+		requestLatency: make(map[string]*Histogram),
+		events:         make(map[string]uint64),
+		clientLatency:  make(map[string]*Histogram),
+		clientErrors:   make(map[string]uint64),
+	}
+}
+
+func observe(m map[string]*Histogram, key string, d time.Duration) {
+	h, ok := m[key]
+	if !ok {
+		h = &Histogram{}
+		m[key] = h
+	}
+	h.Observe(d)
+}
+
+// ObserveRequest records a served request against its route pattern.
+func (m *Metrics) ObserveRequest(route, method string, code int, d time.Duration) {
+	m.Lock()
+	m.requests[labels("route", route, "method", method, "code", fmt.Sprint(code))]++
+	observe(m.requestLatency, labels("route", route), d)
+	m.Unlock()
+}
+
+// IncEvent counts a webhook event by type and processing outcome.
+func (m *Metrics) IncEvent(eventType, outcome string) {
+	m.Lock()
+	m.events[labels("type", eventType, "outcome", outcome)]++
+	m.Unlock()
+}
+
+// ObserveClient records an outbound call to Jenkins or GitHub. Transport
+// errors and 5xx responses are counted as errors.
+func (m *Metrics) ObserveClient(client, method string, d time.Duration, failed bool) {
+	key := labels("client", client, "method", method)
+
+	m.Lock()
+	observe(m.clientLatency, key, d)
+	if failed {
+		m.clientErrors[key]++
+	}
+	m.Unlock()
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	m.Lock()
+	writeCounters(&b, "lanky_http_requests_total", "HTTP requests by route, method and status code.", m.requests)
+	writeHistograms(&b, "lanky_http_request_duration_seconds", "HTTP request latency by route.", m.requestLatency)
+	writeCounters(&b, "lanky_webhook_events_total", "GitHub webhook events by type and outcome.", m.events)
+	writeHistograms(&b, "lanky_client_request_duration_seconds", "Jenkins and GitHub API latency by client and method.", m.clientLatency)
+	writeCounters(&b, "lanky_client_errors_total", "Jenkins and GitHub API errors by client and method.", m.clientErrors)
+	m.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// WriteRuntimeMetrics writes the Go runtime and queue gauges.
+func WriteRuntimeMetrics(w io.Writer, stats *RuntimeStats) (int64, error) {
+	var b strings.Builder
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+
+	writeGauge(&b, "go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	writeGauge(&b, "go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(ms.Sys))
+	writeGauge(&b, "go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(ms.HeapInuse))
+	writeGauge(&b, "go_memstats_heap_sys_bytes", "Number of heap bytes obtained from system.", float64(ms.HeapSys))
+	writeCounter(&b, "go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc))
+	writeCounter(&b, "go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC))
+	fmt.Fprintf(&b, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info%v 1\n", labels("version", runtime.Version()))
+	writeGauge(&b, "process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(stats.Started.Unix()))
+	writeGauge(&b, "lanky_event_queue_depth", "GitHub webhook events waiting to be processed.", float64(stats.QueueDepth()))
+	if rl := githubRateLimit.Snapshot(); rl.Known() {
+		writeGauge(&b, "lanky_github_rate_limit_remaining", "GitHub API requests remaining in the current window.", float64(rl.Remaining))
+		writeGauge(&b, "lanky_github_rate_limit_reset_seconds", "Time the GitHub API quota resets since unix epoch in seconds.", float64(rl.Reset.Unix()))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats name/value pairs as a Prometheus label set.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%v=\"%v\"", pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func writeGauge(b *strings.Builder, name, help string, v float64) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v gauge\n%v %v\n", name, help, name, name, v)
+}
+
+func writeCounter(b *strings.Builder, name, help string, v float64) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v counter\n%v %v\n", name, help, name, name, v)
+}
+
+func writeCounters(b *strings.Builder, name, help string, counters map[string]uint64) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v counter\n", name, help, name)
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(b, "%v%v %v\n", name, key, counters[key])
+	}
+}
+
+func writeHistograms(b *strings.Builder, name, help string, histograms map[string]*Histogram) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v histogram\n", name, help, name)
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		h := histograms[key]
+		// splice the le label into the existing label set
+		prefix := strings.TrimSuffix(key, "}") + ","
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(b, "%v_bucket%vle=\"%v\"} %v\n", name, prefix, le, h.counts[i])
+		}
+		fmt.Fprintf(b, "%v_bucket%vle=\"+Inf\"} %v\n", name, prefix, h.count)
+		fmt.Fprintf(b, "%v_sum%v %v\n", name, key, h.sum)
+		fmt.Fprintf(b, "%v_count%v %v\n", name, key, h.count)
+	}
+}
+
+// instrumentedTransport records the latency and errors of every API call.
+type instrumentedTransport struct {
+	client string
+	http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.RoundTripper
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	metrics.ObserveClient(t.client, req.Method, time.Since(start), err != nil || resp.StatusCode >= 500)
+
+	return resp, err
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request, stats *RuntimeStats) error {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	_, err := metrics.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = WriteRuntimeMetrics(w, stats)
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var labelsTable = []struct {
+	pairs    []string
+	expected string
+}{
+	{[]string{}, `{}`},
+	{[]string{"route", "/"}, `{route="/"}`},
+	{[]string{"type", "push", "outcome", "failed"}, `{type="push",outcome="failed"}`},
+	{[]string{"path", "a\"b\\c\nd"}, `{path="a\"b\\c\nd"}`},
+}
+
+func Test_labels(t *testing.T) {
+	for _, tt := range labelsTable {
+		actual := labels(tt.pairs...)
+		if actual != tt.expected {
+			t.Fatalf("labels(%v) = %v, want %v", tt.pairs, actual, tt.expected)
+		}
+	}
+}
+
+func Test_Metrics_WriteTo_should_expose_counters_and_histograms(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest("/_github", "POST", 202, 30*time.Millisecond)
+	m.ObserveRequest("/_github", "POST", 202, 2*time.Second)
+	m.IncEvent("push", eventProcessed)
+	m.ObserveClient("jenkins", "POST", 10*time.Millisecond, true)
+
+	var b bytes.Buffer
+	_, err := m.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	for _, expected := range []string{
+		`lanky_http_requests_total{route="/_github",method="POST",code="202"} 2`,
+		`lanky_http_request_duration_seconds_bucket{route="/_github",le="0.05"} 1`,
+		`lanky_http_request_duration_seconds_bucket{route="/_github",le="+Inf"} 2`,
+		`lanky_http_request_duration_seconds_count{route="/_github"} 2`,
+		`lanky_webhook_events_total{type="push",outcome="processed"} 1`,
+		`lanky_client_request_duration_seconds_count{client="jenkins",method="POST"} 1`,
+		`lanky_client_errors_total{client="jenkins",method="POST"} 1`,
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Fatalf("metrics = %v, want to contain %v", b.String(), expected)
+		}
+	}
+}
+
+func Test_metricsHandler_should_include_runtime_metrics(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://localhost:9393/metrics", nil)
+	w := httptest.NewRecorder()
+
+	err := metricsHandler(w, r, NewStats())
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	for _, expected := range []string{"# TYPE go_goroutines gauge", "lanky_event_queue_depth 0"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Fatalf("w.Body = %v, want to contain %v", w.Body.String(), expected)
+		}
+	}
+}
+
+func Test_route_should_use_registered_pattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repositories/", http.NotFound)
+
+	r, _ := http.NewRequest("GET", "http://localhost:9393/repositories/baxterthehacker/public-repo", nil)
+	if actual := route(mux, r); actual != "/repositories/" {
+		t.Fatalf("route(mux, r) = %v, want %v", actual, "/repositories/")
+	}
+
+	r, _ = http.NewRequest("GET", "http://localhost:9393/unknown", nil)
+	if actual := route(mux, r); actual != "other" {
+		t.Fatalf("route(mux, r) = %v, want %v", actual, "other")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitReserve requests are kept back from reads for commit statuses
+	// and webhook changes.
+	rateLimitReserve = 10
+	// rateLimitMaxWait is the longest a request is queued for the quota to reset.
+	// Calls are made while serving pages so it stays inside the write timeout.
+	rateLimitMaxWait = 10 * time.Second
+
+	etagCacheLimit = 500
+)
+
+// RateLimitError is returned instead of calling GitHub when the quota is
+// exhausted for longer than rateLimitMaxWait.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("GitHub rate limit exhausted until %v.", e.Reset.Format(time.RFC3339))
+}
+
+// RateLimit is the GitHub quota reported by the most recent response.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	Updated   time.Time
+}
+
+// Known reports whether GitHub has reported a quota yet.
+func (rl RateLimit) Known() bool {
+	return !rl.Updated.IsZero()
+}
+
+func (rl RateLimit) ResetIn() time.Duration {
+	return time.Until(rl.Reset).Round(time.Second)
+}
+
+// RateTracker follows the X-RateLimit headers of GitHub responses.
+type RateTracker struct {
+	sync.Mutex
+	current RateLimit
+}
+
+// githubRateLimit is shared by every GitHub client, like the token cache.
+var githubRateLimit = &RateTracker{}
+
+// Snapshot is a copy of the current quota.
+func (rt *RateTracker) Snapshot() RateLimit {
+	rt.Lock()
+	defer rt.Unlock()
+	return rt.current
+}
+
+// Update records the X-RateLimit headers when present.
+func (rt *RateTracker) Update(h http.Header, now time.Time) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+
+	rt.Lock()
+	rt.current = RateLimit{limit, remaining, time.Unix(reset, 0), now}
+	rt.Unlock()
+}
+
+// Wait is how long to hold a request until the quota resets, zero when it
+// may proceed with more than reserve requests remaining.
+func (rt *RateTracker) Wait(now time.Time, reserve int) time.Duration {
+	rl := rt.Snapshot()
+	if !rl.Known() || rl.Remaining > reserve || !now.Before(rl.Reset) {
+		return 0
+	}
+	return rl.Reset.Sub(now)
+}
+
+type cachedResponse struct {
+	key    string
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// EtagCache keeps the most recent GET responses so they can be revalidated
+// with If-None-Match, 304 responses do not count against the quota.
+type EtagCache struct {
+	sync.Mutex
+	limit   int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var githubEtags = NewEtagCache(etagCacheLimit)
+
+func NewEtagCache(limit int) *EtagCache {
+	return &EtagCache{
+		limit:   limit,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (ec *EtagCache) Get(key string) *cachedResponse {
+	ec.Lock()
+	defer ec.Unlock()
+
+	e, ok := ec.entries[key]
+	if !ok {
+		return nil
+	}
+	ec.order.MoveToFront(e)
+	return e.Value.(*cachedResponse)
+}
+
+func (ec *EtagCache) Put(cr *cachedResponse) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	if e, ok := ec.entries[cr.key]; ok {
+		ec.order.Remove(e)
+	}
+	ec.entries[cr.key] = ec.order.PushFront(cr)
+
+	for ec.order.Len() > ec.limit {
+		oldest := ec.order.Back()
+		ec.order.Remove(oldest)
+		delete(ec.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// Fit raises the limit so at least n responses are kept. It never shrinks
+// the cache.
+func (ec *EtagCache) Fit(n int) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	if n > ec.limit {
+		ec.limit = n
+	}
+}
+
+func (ec *EtagCache) Len() int {
+	ec.Lock()
+	defer ec.Unlock()
+	return ec.order.Len()
+}
+
+// githubTransport holds requests while the quota is nearly exhausted, tracks
+// the rate limit headers and revalidates GET requests with their ETag.
+type githubTransport struct {
+	limit    *RateTracker
+	cache    *EtagCache
+	identity string
+	maxWait  time.Duration
+	http.RoundTripper
+}
+
+// rateLimitWait is rateLimitMaxWait capped at half the write timeout so a
+// page waiting on the quota still gets an error response.
+func rateLimitWait(config *Config) time.Duration {
+	write, err := config.WriteTimeout()
+	if err != nil || write <= 0 || write/2 > rateLimitMaxWait {
+		return rateLimitMaxWait
+	}
+	return write / 2
+}
+
+// cacheKey separates cached responses by credential so tokens never share entries.
+func cacheKey(identity string, req *http.Request) string {
+	return identity + " " + req.URL.String()
+}
+
+// githubIdentity names the credential Lanky calls GitHub with. A GitHub App
+// is named by its installation rather than its token, so the hourly token
+// refresh keeps the cached responses.
+func githubIdentity(g *Github) string {
+	if g.IsApp() {
+		return fmt.Sprintf("app %v/%v/%v", g.AppId, g.InstallationId, g.Organization)
+	}
+	return tokenIdentity(g.Token)
+}
+
+// tokenIdentity hashes a token so it is never held in a cache key.
+func tokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token " + hex.EncodeToString(sum[:8])
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reserve := rateLimitReserve
+	if req.Method != "GET" {
+		reserve = 0
+	}
+
+	wait := t.limit.Wait(time.Now(), reserve)
+	if wait > t.maxWait {
+		return nil, &RateLimitError{time.Now().Add(wait)}
+	}
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	var cached *cachedResponse
+	key := cacheKey(t.identity, req)
+	if req.Method == "GET" {
+		cached = t.cache.Get(key)
+		if cached != nil {
+			req = req.Clone(req.Context())
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+	}
+
+	rt := t.RoundTripper
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.limit.Update(resp.Header, time.Now())
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		for name, values := range cached.header {
+			if _, ok := resp.Header[name]; !ok {
+				resp.Header[name] = values
+			}
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(cached.body))
+		resp.ContentLength = int64(len(cached.body))
+
+	case resp.StatusCode == http.StatusOK && req.Method == "GET" && resp.Header.Get("ETag") != "":
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.cache.Put(&cachedResponse{key, resp.Header.Get("ETag"), resp.Header.Clone(), body})
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRateLimitHeader(remaining int, reset time.Time) http.Header {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", fmt.Sprint(remaining))
+	h.Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+	return h
+}
+
+func Test_RateTracker_Wait(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	reset := now.Add(30 * time.Second)
+
+	rt := &RateTracker{}
+	if wait := rt.Wait(now, rateLimitReserve); wait != 0 {
+		t.Fatalf("unknown quota rt.Wait() = %v, want 0", wait)
+	}
+
+	rt.Update(newRateLimitHeader(rateLimitReserve+1, reset), now)
+	if wait := rt.Wait(now, rateLimitReserve); wait != 0 {
+		t.Fatalf("above reserve rt.Wait() = %v, want 0", wait)
+	}
+
+	rt.Update(newRateLimitHeader(rateLimitReserve, reset), now)
+	if wait := rt.Wait(now, rateLimitReserve); wait != 30*time.Second {
+		t.Fatalf("at reserve rt.Wait() = %v, want %v", wait, 30*time.Second)
+	}
+
+	if wait := rt.Wait(now, 0); wait != 0 {
+		t.Fatalf("writes at reserve rt.Wait() = %v, want 0", wait)
+	}
+
+	if wait := rt.Wait(reset, rateLimitReserve); wait != 0 {
+		t.Fatalf("after reset rt.Wait() = %v, want 0", wait)
+	}
+
+	if rl := rt.Snapshot(); rl.Limit != 5000 || rl.Remaining != rateLimitReserve {
+		t.Fatalf("rt.Snapshot() = %+v, want Limit 5000 Remaining %v", rl, rateLimitReserve)
+	}
+}
+
+func Test_githubTransport_should_revalidate_with_etag(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Link", `<next>; rel="next"`)
+		fmt.Fprint(w, `[{"full_name": "baxterthehacker/public-repo"}]`)
+	}))
+	defer ts.Close()
+
+	limit := &RateTracker{}
+	client := &http.Client{Transport: &githubTransport{limit, NewEtagCache(10), "token test", rateLimitMaxWait, http.DefaultTransport}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(ts.URL + "/orgs/baxterthehacker/repos")
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "public-repo") {
+			t.Fatalf("%v resp = %v %s, want 200 with cached body", i, resp.StatusCode, body)
+		}
+
+		if resp.Header.Get("Link") == "" {
+			t.Fatalf("%v Link header missing, want pagination preserved", i)
+		}
+	}
+
+	if len(requests) != 2 || requests[0] != "" || requests[1] != `"abc"` {
+		t.Fatalf("If-None-Match = %q, want [\"\" \"abc\"]", requests)
+	}
+
+	if rl := limit.Snapshot(); rl.Remaining != 4999 {
+		t.Fatalf("limit.Snapshot().Remaining = %v, want %v", rl.Remaining, 4999)
+	}
+}
+
+func Test_githubTransport_should_refuse_when_exhausted(t *testing.T) {
+	limit := &RateTracker{}
+	limit.Update(newRateLimitHeader(0, time.Now().Add(time.Hour)), time.Now())
+	client := &http.Client{Transport: &githubTransport{limit, NewEtagCache(10), "token test", rateLimitMaxWait, http.DefaultTransport}}
+
+	_, err := client.Get("http://localhost:0/orgs/baxterthehacker/repos")
+	if err == nil || !strings.Contains(err.Error(), "rate limit exhausted") {
+		t.Fatalf("err = %v, want RateLimitError", err)
+	}
+}
+
+func Test_EtagCache_should_evict_least_recently_used(t *testing.T) {
+	ec := NewEtagCache(2)
+	ec.Put(&cachedResponse{key: "a"})
+	ec.Put(&cachedResponse{key: "b"})
+	ec.Get("a")
+	ec.Put(&cachedResponse{key: "c"})
+
+	if ec.Get("b") != nil || ec.Get("a") == nil || ec.Len() != 2 {
+		t.Fatalf("ec = %v entries, want a and c retained", ec.Len())
+	}
+}
+
+func Test_EtagCache_Fit_should_only_grow(t *testing.T) {
+	ec := NewEtagCache(2)
+	ec.Fit(3)
+	ec.Fit(1)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		ec.Put(&cachedResponse{key: key})
+	}
+
+	if ec.Len() != 3 {
+		t.Fatalf("ec.Len() = %v, want %v", ec.Len(), 3)
+	}
+}
+
+var githubIdentityTable = []struct {
+	github   *Github
+	expected string
+}{
+	{&Github{AppId: 42, Organization: "baxterthehacker", Token: "abc123"}, "app 42/0/baxterthehacker"},
+	{&Github{AppId: 42, InstallationId: 7}, "app 42/7/"},
+	{&Github{Token: "abc123"}, tokenIdentity("abc123")},
+}
+
+func Test_githubIdentity(t *testing.T) {
+	for _, tt := range githubIdentityTable {
+		actual := githubIdentity(tt.github)
+		if actual != tt.expected {
+			t.Fatalf("githubIdentity(%+v) = %v, want %v", tt.github, actual, tt.expected)
+		}
+	}
+}
+
+func Test_tokenIdentity_should_hide_and_separate_tokens(t *testing.T) {
+	a := tokenIdentity("abc123")
+	if strings.Contains(a, "abc123") || a == tokenIdentity("def456") {
+		t.Fatalf("tokenIdentity(abc123) = %v, want a distinct hash", a)
+	}
+}
+
+func Test_githubTransport_should_revalidate_after_token_refresh(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		fmt.Fprint(w, `[{"id": 7}]`)
+	}))
+	defer ts.Close()
+
+	rt := &githubTransport{&RateTracker{}, NewEtagCache(10), "app 42/7/", rateLimitMaxWait, http.DefaultTransport}
+
+	for _, token := range []string{"first", "refreshed"} {
+		req, _ := http.NewRequest("GET", ts.URL+"/repos/baxterthehacker/public-repo/hooks", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(requests) != 2 || requests[1] != `"abc"` {
+		t.Fatalf("If-None-Match = %q, want [\"\" \"abc\"]", requests)
+	}
+}
+
+var rateLimitWaitTable = []struct {
+	server   *Server
+	expected time.Duration
+}{
+	{nil, rateLimitMaxWait},
+	{&Server{WriteTimeout: "10s"}, 5 * time.Second},
+	{&Server{WriteTimeout: "0s"}, rateLimitMaxWait},
+	{&Server{WriteTimeout: "5m"}, rateLimitMaxWait},
+}
+
+func Test_rateLimitWait_should_stay_inside_write_timeout(t *testing.T) {
+	for _, tt := range rateLimitWaitTable {
+		if actual := rateLimitWait(&Config{Server: tt.server}); actual != tt.expected {
+			t.Fatalf("rateLimitWait(%+v) = %v, want %v", tt.server, actual, tt.expected)
+		}
+	}
+}
+
+func Test_githubTransport_should_keep_reserve_for_writes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	limit := &RateTracker{}
+	limit.Update(newRateLimitHeader(rateLimitReserve/2, time.Now().Add(time.Hour)), time.Now())
+	client := &http.Client{Transport: &githubTransport{limit, NewEtagCache(10), "token test", rateLimitMaxWait, http.DefaultTransport}}
+
+	_, err := client.Get(ts.URL + "/orgs/baxterthehacker/repos")
+	if err == nil {
+		t.Fatalf("GET err = nil, want RateLimitError")
+	}
+
+	resp, err := client.Post(ts.URL+"/repos/baxterthehacker/public-repo/statuses/abc", jsonContentType, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST err = %v, want nil", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	hookName        = "web"
+	hookContentType = "json"
+
+	driftNone    = "ok"
+	driftCreated = "created"
+	driftUpdated = "updated"
+	driftError   = "error"
+
+	changeSecret = "secret"
+)
+
+// hookEvents are the GitHub events Lanky subscribes to.
+var hookEvents = []string{"push", "pull_request"}
+
+type HookDrift struct {
+	Repository string
+	Action     string
+	Changes    []string
+	Err        error
+}
+
+func (hd *HookDrift) String() string {
+	switch hd.Action {
+	case driftError:
+		return fmt.Sprintf("%v %v: %v", hd.Action, hd.Repository, hd.Err)
+	case driftUpdated:
+		return fmt.Sprintf("%v %v: %v", hd.Action, hd.Repository, strings.Join(hd.Changes, ", "))
+	}
+	return fmt.Sprintf("%v %v", hd.Action, hd.Repository)
+}
+
+// SecretOnly reports whether the hook was only sent the current secret.
+func (hd *HookDrift) SecretOnly() bool {
+	return hd.Action == driftUpdated && len(hd.Changes) == 1 && hd.Changes[0] == changeSecret
+}
+
+// ReconcileHooks ensures every organisation repository has a Lanky webhook
+// with the expected events, content type and secret.
+func ReconcileHooks(config *Config) (drift []*HookDrift, err error) {
+	cl := NewGithub(config)
+	if cl == nil {
+		return nil, errors.New("Github configuration is invalid.")
+	}
+
+	reps := make(Repositories, 0, 100)
+	err = cl.ListRepositories(config.Github.Organization, &reps)
+	if err != nil {
+		return nil, err
+	}
+	// keep every hook list between passes so they are revalidated.
+	githubEtags.Fit(etagCacheLimit + len(reps))
+
+	expected := &HookRequest{
+		Name:   hookName,
+		Active: true,
+		Events: hookEvents,
+		Config: HookConfig{
+			Url:         Url(config.HookUrl()),
+			ContentType: hookContentType,
+			Secret:      config.Github.CurrentHookSecret(),
+		},
+	}
+
+	for i := range reps {
+		drift = append(drift, reconcileHook(cl, reps[i].FullName, expected))
+	}
+
+	return drift, nil
+}
+
+func reconcileHook(cl *GithubClient, fullName string, expected *HookRequest) *HookDrift {
+	hd := &HookDrift{Repository: fullName}
+
+	hooks := make(Hooks, 0, 100)
+	hd.Err = cl.ListHooks(fullName, &hooks)
+	if hd.Err != nil {
+		hd.Action = driftError
+		return hd
+	}
+
+	var hook *Hook
+	for i := range hooks {
+		if hooks[i].Config.Url == expected.Config.Url {
+			hook = &hooks[i]
+			break
+		}
+	}
+
+	if hook == nil {
+		hd.Action = driftCreated
+		hd.Err = cl.CreateHook(fullName, expected)
+	} else {
+		hd.Changes = hookChanges(hook, expected)
+		if expected.Config.Secret != "" {
+			// GitHub never returns the secret, so it is sent to every hook to
+			// install the current secret after a rotation.
+			hd.Changes = append(hd.Changes, changeSecret)
+		}
+		if len(hd.Changes) == 0 {
+			hd.Action = driftNone
+			return hd
+		}
+		hd.Action = driftUpdated
+		hd.Err = cl.EditHook(fullName, hook.Id, expected)
+	}
+
+	if hd.Err != nil {
+		hd.Action = driftError
+	}
+
+	return hd
+}
+
+// hookChanges describes how an installed hook differs from the expected one.
+// The secret cannot be compared as GitHub never returns it.
+func hookChanges(hook *Hook, expected *HookRequest) (changes []string) {
+	if hook.Active != expected.Active {
+		changes = append(changes, fmt.Sprintf("active %v -> %v", hook.Active, expected.Active))
+	}
+
+	if hook.Config.ContentType != expected.Config.ContentType {
+		changes = append(changes, fmt.Sprintf("content_type %v -> %v", hook.Config.ContentType, expected.Config.ContentType))
+	}
+
+	actual := append([]string{}, hook.Events...)
+	want := append([]string{}, expected.Events...)
+	sort.Strings(actual)
+	sort.Strings(want)
+	if strings.Join(actual, ",") != strings.Join(want, ",") {
+		changes = append(changes, fmt.Sprintf("events %v -> %v", actual, want))
+	}
+
+	return changes
+}
+
+// ReconcileHooksEvery reconciles the organisation webhooks on a fixed interval
+// until stop is closed.
+func ReconcileHooksEvery(configs *ConfigStore, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			drift, err := ReconcileHooks(configs.Config())
+			if err != nil {
+				glog.Errorf("Webhook reconciliation failed: %v", err)
+				continue
+			}
+
+			for _, hd := range drift {
+				switch {
+				case hd.Action == driftNone:
+				case hd.SecretOnly():
+					glog.Infof("Webhook reconciliation %v", hd)
+				default:
+					glog.Warningf("Webhook reconciliation %v", hd)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newExpectedHook(url string, events ...string) *HookRequest {
+	return &HookRequest{
+		Name:   hookName,
+		Active: true,
+		Events: events,
+		Config: HookConfig{
+			Url:         Url(url),
+			ContentType: hookContentType,
+			Secret:      "abc123",
+		},
+	}
+}
+
+var hookChangesTable = []struct {
+	hook     Hook
+	expected int
+}{
+	{Hook{Active: true, Events: []string{"pull_request", "push"}, Config: HookConfig{ContentType: "json"}}, 0},
+	{Hook{Active: false, Events: []string{"push", "pull_request"}, Config: HookConfig{ContentType: "json"}}, 1},
+	{Hook{Active: true, Events: []string{"push"}, Config: HookConfig{ContentType: "form"}}, 2},
+}
+
+func Test_hookChanges(t *testing.T) {
+	expected := newExpectedHook("http://lanky.local/_github", "push", "pull_request")
+
+	for _, tt := range hookChangesTable {
+		changes := hookChanges(&tt.hook, expected)
+		if len(changes) != tt.expected {
+			t.Fatalf("hookChanges(%v) = %v, want %v changes", tt.hook, changes, tt.expected)
+		}
+	}
+}
+
+func Test_reconcileHook_should_report_no_drift_without_secret(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validHookResponse)
+	gc := &GithubClient{WebClient: tc}
+
+	expected := newExpectedHook("http://example.com/webhook", "push", "pull_request")
+	expected.Config.Secret = ""
+	hd := reconcileHook(gc, "octocat/Hello-World", expected)
+
+	if hd.Action != driftNone {
+		t.Fatalf("hd.Action = %v, want %v", hd.Action, driftNone)
+	}
+
+	if len(tc.bodies) != 0 {
+		t.Fatalf("len(tc.bodies) = %v, want 0", len(tc.bodies))
+	}
+}
+
+func Test_reconcileHook_should_send_secret_to_up_to_date_hook(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validHookResponse)
+	tc.status = http.StatusOK
+	gc := &GithubClient{WebClient: tc}
+
+	hd := reconcileHook(gc, "octocat/Hello-World", newExpectedHook("http://example.com/webhook", "push", "pull_request"))
+
+	if !hd.SecretOnly() {
+		t.Fatalf("hd = %v, want secret only update", hd)
+	}
+
+	if len(tc.bodies) != 1 || !strings.Contains(tc.bodies[0], `"secret":"abc123"`) {
+		t.Fatalf("tc.bodies = %v, want PATCH with secret", tc.bodies)
+	}
+}
+
+func Test_reconcileHook_should_create_missing_hook(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validHookResponse)
+	tc.status = http.StatusCreated
+	gc := &GithubClient{WebClient: tc}
+
+	hd := reconcileHook(gc, "octocat/Hello-World", newExpectedHook("http://lanky.local/_github", "push", "pull_request"))
+
+	if hd.Action != driftCreated {
+		t.Fatalf("hd.Action = %v, want %v (%v)", hd.Action, driftCreated, hd.Err)
+	}
+
+	expectedUrl := "https://api.github.com/repos/octocat/Hello-World/hooks"
+	if tc.urls[1] != expectedUrl {
+		t.Fatalf("tc.urls[1] = %v, want %v", tc.urls[1], expectedUrl)
+	}
+
+	if !strings.Contains(tc.bodies[0], `"secret":"abc123"`) {
+		t.Fatalf("tc.bodies[0] = %v, want to contain secret", tc.bodies[0])
+	}
+}
+
+func Test_reconcileHook_should_update_drifted_hook(t *testing.T) {
+	tc := newClient()
+	tc.responses = append(tc.responses, validHookResponse)
+	tc.status = http.StatusOK
+	gc := &GithubClient{WebClient: tc}
+
+	hd := reconcileHook(gc, "octocat/Hello-World", newExpectedHook("http://example.com/webhook", "push"))
+
+	if hd.Action != driftUpdated {
+		t.Fatalf("hd.Action = %v, want %v (%v)", hd.Action, driftUpdated, hd.Err)
+	}
+
+	expectedUrl := "https://api.github.com/repos/octocat/Hello-World/hooks/1"
+	if tc.urls[1] != expectedUrl {
+		t.Fatalf("tc.urls[1] = %v, want %v", tc.urls[1], expectedUrl)
+	}
+
+	expected := "updated octocat/Hello-World: events [pull_request push] -> [push], secret"
+	if hd.String() != expected {
+		t.Fatalf("hd.String() = %v, want %v", hd.String(), expected)
+	}
+}
+
+func Test_reconcileHook_should_report_error(t *testing.T) {
+	gc := &GithubClient{WebClient: newClient()}
+
+	hd := reconcileHook(gc, "octocat/Hello-World", newExpectedHook("http://example.com/webhook", "push"))
+
+	if hd.Action != driftError {
+		t.Fatalf("hd.Action = %v, want %v", hd.Action, driftError)
+	}
+}
+
+func Test_ReconcileHooks_with_invalid_config_should_return_error(t *testing.T) {
+	_, err := ReconcileHooks(&Config{})
+
+	expected := "Github configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
+
+func Test_ReconcileHooks_should_install_new_secret_after_rotation(t *testing.T) {
+	var patched []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/orgs/baxterthehacker/repos":
+			fmt.Fprint(w, `[{"id": 1, "name": "public-repo", "full_name": "baxterthehacker/public-repo"}]`)
+		case r.URL.Path == "/api/repos/baxterthehacker/public-repo/hooks":
+			fmt.Fprint(w, `[{"id": 7, "active": true, "events": ["push", "pull_request"], "config": {"url": "http://lanky.local/_github", "content_type": "json"}}]`)
+		case r.Method == "PATCH" && r.URL.Path == "/api/repos/baxterthehacker/public-repo/hooks/7":
+			b, _ := ioutil.ReadAll(r.Body)
+			patched = append(patched, string(b))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	config := &Config{
+		BaseUrl: "http://lanky.local",
+		Github: &Github{
+			Token:        "abc123",
+			ApiUrl:       ts.URL + "/api",
+			Organization: "baxterthehacker",
+			HookSecret:   "new-secret",
+			HookSecrets:  []HookSecret{{Name: "previous", Secret: "old-secret", Expires: time.Now().Add(time.Hour)}},
+		},
+	}
+
+	drift, err := ReconcileHooks(config)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if len(drift) != 1 || !drift[0].SecretOnly() {
+		t.Fatalf("drift = %v, want secret only update", drift)
+	}
+
+	if len(patched) != 1 || !strings.Contains(patched[0], `"secret":"new-secret"`) {
+		t.Fatalf("patched = %v, want new-secret installed", patched)
+	}
+}
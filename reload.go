@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unicode"
+
+	"github.com/golang/glog"
+)
+
+// secretFields are never logged, only reported as changed.
+var secretFields = map[string]bool{
+	"Token":         true,
+	"Password":      true,
+	"ClientSecret":  true,
+	"HookSecret":    true,
+	"HookSecrets":   true,
+	"NotifySecret":  true,
+	"SessionSecret": true,
+}
+
+// restartFields are read once at startup and only take effect after a restart.
+var restartFields = map[string]bool{
+	"address":                  true,
+	"certificatePath":          true,
+	"keyPath":                  true,
+	"databaseUrl":              true,
+	"workers":                  true,
+	"queueSize":                true,
+	"github.reconcileInterval": true,
+	"server.readTimeout":       true,
+	"server.writeTimeout":      true,
+	"server.idleTimeout":       true,
+	"server.maxHeaderBytes":    true,
+	"admin.address":            true,
+}
+
+// ReadConfig loads the config file, applies the environment overrides and validates the result.
+func ReadConfig(path string, lookup func(string) (string, bool)) (*Config, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	config := &Config{}
+	err = LoadConfig(r, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ApplyEnv(config, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ConfigStore holds the running configuration which is swapped atomically on reload.
+type ConfigStore struct {
+	path    string
+	lookup  func(string) (string, bool)
+	reload  sync.Mutex
+	current atomic.Value
+}
+
+func NewConfigStore(path string, lookup func(string) (string, bool), config *Config) *ConfigStore {
+	cs := &ConfigStore{path: path, lookup: lookup}
+	cs.current.Store(config)
+	return cs
+}
+
+// Config is the configuration in effect, callers should not hold it across requests.
+func (cs *ConfigStore) Config() *Config {
+	return cs.current.Load().(*Config)
+}
+
+// Reload re-reads the config file and swaps it in when valid, returning the changed fields.
+func (cs *ConfigStore) Reload() ([]string, error) {
+	cs.reload.Lock()
+	defer cs.reload.Unlock()
+
+	config, err := ReadConfig(cs.path, cs.lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	err = templates.Configure(config.TemplatesDir, config.TemplatesReload)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := ConfigDiff(cs.Config(), config)
+	cs.current.Store(config)
+
+	return changes, nil
+}
+
+// ConfigDiff describes the fields that differ between old and new. Secret
+// values are never included.
+func ConfigDiff(old, new *Config) []string {
+	var changes []string
+	diffFields(reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "", &changes)
+	return changes
+}
+
+func diffFields(old, new reflect.Value, prefix string, changes *[]string) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := prefix + fieldName(f.Name)
+		o, n := old.Field(i), new.Field(i)
+
+		if f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct {
+			diffFields(sectionValue(o), sectionValue(n), name+".", changes)
+			continue
+		}
+
+		if reflect.DeepEqual(o.Interface(), n.Interface()) {
+			continue
+		}
+
+		change := fmt.Sprintf("%v: %v -> %v", name, o.Interface(), n.Interface())
+		if secretFields[f.Name] {
+			change = name + " changed"
+		}
+		if restartFields[name] {
+			change += " (requires restart)"
+		}
+		*changes = append(*changes, change)
+	}
+}
+
+// sectionValue dereferences a config section, treating nil as the zero value.
+func sectionValue(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return reflect.New(v.Type().Elem()).Elem()
+	}
+	return v.Elem()
+}
+
+// fieldName is the JSON style name of a config field, e.g. BaseUrl to baseUrl.
+func fieldName(field string) string {
+	runes := []rune(field)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func logReload(changes []string) {
+	glog.Warningf("Configuration reloaded with %v changes.", len(changes))
+	for _, change := range changes {
+		glog.Warningf("Configuration changed %v", change)
+	}
+}
+
+func reloadOnSignal(configs *ConfigStore) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		changes, err := configs.Reload()
+		if err != nil {
+			glog.Errorf("Configuration reload failed, keeping current configuration: %v", err)
+			continue
+		}
+		logReload(changes)
+	}
+}
+
+func reloadHandler(w http.ResponseWriter, r *http.Request, configs *ConfigStore) error {
+	if r.Method != "POST" {
+		http.Error(w, "Unauthorized", http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	config := configs.Config()
+	if !config.Admin.HasCredentials() {
+		return errors.New("Admin configuration is invalid.")
+	}
+
+	if !adminAuthorized(w, r, config.Admin) {
+		return nil
+	}
+
+	changes, err := configs.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil
+	}
+	logReload(changes)
+
+	fmt.Fprintf(w, "Reloaded: %v changes\n", len(changes))
+	fmt.Fprint(w, strings.Join(changes, "\n"))
+
+	return nil
+}
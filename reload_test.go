@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reloadJson = `{
+	"address": ":9393",
+	"jenkins": {"baseUrl": "%v", "trayFeed": "/cc.xml"},
+	"github": {"token": "%v", "hookSecret": "abc123"},
+	"admin": {"user": "admin", "password": "secret"}
+}`
+
+func writeConfig(t *testing.T, path, jenkinsUrl, token string) {
+	err := ioutil.WriteFile(path, []byte(fmt.Sprintf(reloadJson, jenkinsUrl, token)), 0644)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func noEnv(string) (string, bool) { return "", false }
+
+func newConfigStore(t *testing.T) (*ConfigStore, string) {
+	path := filepath.Join(t.TempDir(), "lanky.json")
+	writeConfig(t, path, "http://jenkins.local", "token1")
+
+	config, err := ReadConfig(path, noEnv)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	return NewConfigStore(path, noEnv, config), path
+}
+
+func Test_ConfigDiff_should_hide_secrets_and_flag_restarts(t *testing.T) {
+	old := &Config{Address: ":9393", Github: &Github{Token: "token1"}}
+	new := &Config{Address: ":8080", Github: &Github{Token: "token2"}, Jenkins: &Jenkins{BaseUrl: "http://ci.local"}}
+
+	changes := ConfigDiff(old, new)
+	expected := []string{
+		"address: :9393 -> :8080 (requires restart)",
+		"jenkins.baseUrl:  -> http://ci.local",
+		"github.token changed",
+	}
+
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("ConfigDiff() = %v, want %v", changes, expected)
+	}
+}
+
+func Test_ConfigStore_Reload_should_swap_valid_config(t *testing.T) {
+	cs, path := newConfigStore(t)
+	before := cs.Config()
+
+	writeConfig(t, path, "http://ci.local", "token2")
+
+	changes, err := cs.Reload()
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("len(changes) = %v, want %v: %v", len(changes), 2, changes)
+	}
+
+	if cs.Config().Jenkins.BaseUrl != "http://ci.local" {
+		t.Fatalf("cs.Config().Jenkins.BaseUrl = %v, want %v", cs.Config().Jenkins.BaseUrl, "http://ci.local")
+	}
+
+	if before.Jenkins.BaseUrl != "http://jenkins.local" {
+		t.Fatalf("before.Jenkins.BaseUrl = %v, want unchanged", before.Jenkins.BaseUrl)
+	}
+}
+
+func Test_ConfigStore_Reload_should_keep_config_when_invalid(t *testing.T) {
+	cs, path := newConfigStore(t)
+
+	writeConfig(t, path, "ci.local", "token2")
+
+	_, err := cs.Reload()
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+
+	if cs.Config().Github.Token != "token1" {
+		t.Fatalf("cs.Config().Github.Token = %v, want %v", cs.Config().Github.Token, "token1")
+	}
+}
+
+func Test_reloadHandler_should_require_admin(t *testing.T) {
+	cs, _ := newConfigStore(t)
+
+	r, _ := http.NewRequest("POST", "http://localhost:9393/_reload", nil)
+	w := httptest.NewRecorder()
+	err := reloadHandler(w, r, cs)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+
+	r.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	err = reloadHandler(w, r, cs)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if !strings.HasPrefix(w.Body.String(), "Reloaded: 0 changes") {
+		t.Fatalf("w.Body = %v, want %v", w.Body.String(), "Reloaded: 0 changes")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	defaultRefreshInterval = 10 * time.Minute
+	defaultRefreshJitter   = time.Minute
+)
+
+// RepositoryCache holds the organisation's repositories, refreshed in the
+// background so pages never wait on GitHub.
+type RepositoryCache struct {
+	sync.RWMutex
+	refresh   sync.Mutex
+	repos     Repositories
+	updatedAt time.Time
+	err       error
+	failedAt  time.Time
+}
+
+// RepositorySnapshot is the cache content at a point in time.
+type RepositorySnapshot struct {
+	Repositories Repositories
+	UpdatedAt    time.Time
+	Error        error
+	FailedAt     time.Time
+}
+
+// Loaded reports whether a refresh has succeeded since startup.
+func (rs *RepositorySnapshot) Loaded() bool {
+	return !rs.UpdatedAt.IsZero()
+}
+
+func NewRepositoryCache() *RepositoryCache {
+	return &RepositoryCache{}
+}
+
+func (rc *RepositoryCache) Snapshot() *RepositorySnapshot {
+	rc.RLock()
+	defer rc.RUnlock()
+
+	return &RepositorySnapshot{
+		Repositories: rc.repos,
+		UpdatedAt:    rc.updatedAt,
+		Error:        rc.err,
+		FailedAt:     rc.failedAt,
+	}
+}
+
+// Refresh reloads the repositories, keeping the previous list when it fails.
+func (rc *RepositoryCache) Refresh(config *Config) error {
+	rc.refresh.Lock()
+	defer rc.refresh.Unlock()
+
+	err := rc.list(config)
+
+	rc.Lock()
+	rc.err = err
+	if err != nil {
+		rc.failedAt = time.Now()
+	}
+	rc.Unlock()
+
+	return err
+}
+
+func (rc *RepositoryCache) list(config *Config) error {
+	cl := NewGithub(config)
+	if cl == nil {
+		return errors.New("Github configuration is invalid.")
+	}
+
+	reps := make(Repositories, 0, 100)
+	err := cl.ListRepositories(config.Github.Organization, &reps)
+	if err != nil {
+		return err
+	}
+
+	rc.Lock()
+	rc.repos = reps
+	rc.updatedAt = time.Now()
+	rc.Unlock()
+
+	return nil
+}
+
+// RefreshEvery loads the repositories immediately and then every refresh
+// interval plus a random jitter, reading both from the current config.
+func (rc *RepositoryCache) RefreshEvery(configs *ConfigStore, stop <-chan struct{}) {
+	for {
+		config := configs.Config()
+		if config.Github.HasCredentials() {
+			err := rc.Refresh(config)
+			if err != nil {
+				glog.Errorf("Repository refresh failed: %v", err)
+			}
+		}
+
+		timer := time.NewTimer(refreshDelay(config))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// refreshDelay is the interval plus up to the jitter so several instances
+// do not call GitHub in step. Invalid settings fall back to the defaults.
+func refreshDelay(config *Config) time.Duration {
+	interval, err := config.RefreshInterval()
+	if err != nil {
+		interval = defaultRefreshInterval
+	}
+
+	jitter, err := config.RefreshJitter()
+	if err != nil {
+		jitter = defaultRefreshJitter
+	}
+
+	if jitter <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newReposServer serves the organisation's repositories until failing is set.
+func newReposServer(failing *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(failing) != 0 {
+			http.Error(w, "GitHub is down", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `[{"id": 1, "full_name": "baxterthehacker/public-repo"}]`)
+	}))
+}
+
+func reposConfig(ts *httptest.Server) *Config {
+	return &Config{Github: &Github{Token: "abc123", ApiUrl: ts.URL + "/api", Organization: "baxterthehacker"}}
+}
+
+func Test_RepositoryCache_Refresh_should_keep_repositories_on_failure(t *testing.T) {
+	var failing int32
+	ts := newReposServer(&failing)
+	defer ts.Close()
+
+	rc := NewRepositoryCache()
+	err := rc.Refresh(reposConfig(ts))
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	snapshot := rc.Snapshot()
+	if !snapshot.Loaded() || len(snapshot.Repositories) != 1 || snapshot.Error != nil {
+		t.Fatalf("snapshot = %+v, want 1 repository without error", snapshot)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	err = rc.Refresh(reposConfig(ts))
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+
+	snapshot = rc.Snapshot()
+	if len(snapshot.Repositories) != 1 || snapshot.Error == nil || snapshot.FailedAt.IsZero() {
+		t.Fatalf("snapshot = %+v, want previous repositories with error", snapshot)
+	}
+}
+
+func Test_RepositoryCache_RefreshEvery_should_load_at_start(t *testing.T) {
+	var failing int32
+	ts := newReposServer(&failing)
+	defer ts.Close()
+
+	rc := NewRepositoryCache()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		rc.RefreshEvery(NewConfigStore("", noEnv, reposConfig(ts)), stop)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !rc.Snapshot().Loaded() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	if !rc.Snapshot().Loaded() {
+		t.Fatalf("rc.Snapshot().Loaded() = false, want true")
+	}
+}
+
+var refreshDelayTable = []struct {
+	github *Github
+	min    time.Duration
+	max    time.Duration
+}{
+	{nil, defaultRefreshInterval, defaultRefreshInterval + defaultRefreshJitter},
+	{&Github{RefreshInterval: "2m", RefreshJitter: "0s"}, 2 * time.Minute, 2 * time.Minute},
+	{&Github{RefreshInterval: "2m", RefreshJitter: "30s"}, 2 * time.Minute, 2*time.Minute + 30*time.Second},
+	{&Github{RefreshInterval: "often"}, defaultRefreshInterval, defaultRefreshInterval + defaultRefreshJitter},
+}
+
+func Test_refreshDelay_should_add_jitter_to_interval(t *testing.T) {
+	for _, tt := range refreshDelayTable {
+		d := refreshDelay(&Config{Github: tt.github})
+		if d < tt.min || d > tt.max {
+			t.Fatalf("refreshDelay(%+v) = %v, want between %v and %v", tt.github, d, tt.min, tt.max)
+		}
+	}
+}
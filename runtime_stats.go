@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,9 +19,34 @@ type RuntimeStats struct {
 	status3xx uint64
 	status4xx uint64
 	status5xx uint64
+	sigSha1   uint64
+	sigSha256 uint64
+	secrets   map[string]uint64
+	queued    int64
+	processed uint64
+	failed    uint64
 	memStats  *runtime.MemStats
 }
 
+const (
+	algorithmSha1   = "sha1"
+	algorithmSha256 = "sha256"
+
+	eventProcessed = "processed"
+	eventFailed    = "failed"
+
+	// outcomes of deliveries refused or answered by /_github without queueing
+	eventRejected         = "rejected"
+	eventInvalidSignature = "invalid_signature"
+	eventPing             = "ping"
+	eventUnsupported      = "unsupported"
+	eventInvalidPayload   = "invalid_payload"
+	eventDuplicate        = "duplicate"
+	eventQueueFull        = "queue_full"
+	eventQueueClosed      = "queue_closed"
+	eventError            = "error"
+)
+
 func (rs *RuntimeStats) StartDate() string {
 	return rs.Started.Format("2006-01-02 15:04")
 }
@@ -72,6 +98,65 @@ func (rs *RuntimeStats) Status3xx() uint64 { return atomic.LoadUint64(&rs.status
 func (rs *RuntimeStats) Status4xx() uint64 { return atomic.LoadUint64(&rs.status4xx) }
 func (rs *RuntimeStats) Status5xx() uint64 { return atomic.LoadUint64(&rs.status5xx) }
 
+// IncSignature counts a webhook verified with the named HMAC algorithm.
+func (rs *RuntimeStats) IncSignature(algorithm string) {
+	switch algorithm {
+	case algorithmSha1:
+		rs.inc(&rs.sigSha1)
+	case algorithmSha256:
+		rs.inc(&rs.sigSha256)
+	}
+}
+
+func (rs *RuntimeStats) SignatureSha1() uint64   { return atomic.LoadUint64(&rs.sigSha1) }
+func (rs *RuntimeStats) SignatureSha256() uint64 { return atomic.LoadUint64(&rs.sigSha256) }
+
+// AddQueueDepth adjusts the number of events waiting to be processed.
+func (rs *RuntimeStats) AddQueueDepth(delta int64) {
+	atomic.AddInt64(&rs.queued, delta)
+}
+
+// IncEvent counts a webhook event by processing outcome.
+func (rs *RuntimeStats) IncEvent(outcome string) {
+	switch outcome {
+	case eventProcessed:
+		rs.inc(&rs.processed)
+	case eventFailed:
+		rs.inc(&rs.failed)
+	}
+}
+
+func (rs *RuntimeStats) QueueDepth() int64       { return atomic.LoadInt64(&rs.queued) }
+func (rs *RuntimeStats) EventsProcessed() uint64 { return atomic.LoadUint64(&rs.processed) }
+func (rs *RuntimeStats) EventsFailed() uint64    { return atomic.LoadUint64(&rs.failed) }
+
+// GithubRateLimit is the most recently reported GitHub API quota.
+func (rs *RuntimeStats) GithubRateLimit() RateLimit { return githubRateLimit.Snapshot() }
+
+type SecretCount struct {
+	Name  string
+	Count uint64
+}
+
+// IncSecret counts a webhook verified with the named hook secret.
+func (rs *RuntimeStats) IncSecret(name string) {
+	rs.Lock()
+	rs.secrets[name]++
+	rs.Unlock()
+}
+
+// SecretMatches is the number of verified webhooks per hook secret sorted by name.
+// The caller must hold the read lock.
+func (rs *RuntimeStats) SecretMatches() []SecretCount {
+	counts := make([]SecretCount, 0, len(rs.secrets))
+	for name, count := range rs.secrets {
+		counts = append(counts, SecretCount{name, count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Name < counts[j].Name })
+
+	return counts
+}
+
 func (rs *RuntimeStats) toBytes(b uint64) string {
 	var val float64
 	var prefix string
@@ -113,6 +198,7 @@ func (rs *RuntimeStats) Update() {
 func NewStats() *RuntimeStats {
 	return &RuntimeStats{
 		Started:  time.Now(),
+		secrets:  make(map[string]uint64),
 		memStats: &runtime.MemStats{},
 	}
 }
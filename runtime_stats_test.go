@@ -77,3 +77,37 @@ func Test_IncStatus_with_invalid_status_codes(t *testing.T) {
 		}
 	}
 }
+
+func Test_IncSignature(t *testing.T) {
+	rs := NewStats()
+
+	rs.IncSignature("sha256")
+	rs.IncSignature("sha256")
+	rs.IncSignature("sha1")
+	rs.IncSignature("md5")
+
+	if rs.SignatureSha256() != 2 {
+		t.Fatalf("rs.SignatureSha256() = %v, want 2", rs.SignatureSha256())
+	}
+
+	if rs.SignatureSha1() != 1 {
+		t.Fatalf("rs.SignatureSha1() = %v, want 1", rs.SignatureSha1())
+	}
+}
+
+func Test_SecretMatches_should_be_sorted_by_name(t *testing.T) {
+	rs := NewStats()
+
+	rs.IncSecret("previous")
+	rs.IncSecret("current")
+	rs.IncSecret("current")
+
+	matches := rs.SecretMatches()
+	if len(matches) != 2 {
+		t.Fatalf("len(matches) = %v, want 2", len(matches))
+	}
+
+	if matches[0].Name != "current" || matches[0].Count != 2 {
+		t.Fatalf("matches[0] = %v, want {current 2}", matches[0])
+	}
+}
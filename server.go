@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 )
@@ -33,9 +37,12 @@ type LoggingHandler struct {
 func (lh *LoggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// AFAICT WriteHeader is only called when not 200 OK.
 	bw := &ByteWriter{w, 0, 200}
+	start := time.Now()
 
 	lh.Handler.ServeHTTP(bw, r)
 
+	metrics.ObserveRequest(route(lh.Handler, r), r.Method, bw.Status, time.Since(start))
+
 	ip := strings.Split(r.RemoteAddr, ":")[0]
 	if r.URL.Path != "/status" {
 		err := lh.RuntimeStats.IncStatus(bw.Status)
@@ -46,40 +53,239 @@ func (lh *LoggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	glog.Infof("%v %v - \"%v %v %v\" %v %v", ip, r.Header.Get("User-Agent"), r.Method, r.URL.Path, r.Proto, bw.Status, bw.Wrote)
 }
 
-func HandleFuncConfig(path string, fn func(w http.ResponseWriter, r *http.Request, c *Config) error, c *Config) {
-	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		err := fn(w, r, c)
+// route is the registered pattern serving r, keeping metric labels bounded.
+func route(h http.Handler, r *http.Request) string {
+	mux, ok := h.(*http.ServeMux)
+	if !ok {
+		return "other"
+	}
+
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "other"
+	}
+	return pattern
+}
+
+func HandleFuncConfig(mux *http.ServeMux, path string, fn func(w http.ResponseWriter, r *http.Request, c *Config) error, cs *ConfigStore) {
+	mux.HandleFunc(path, configHandler(fn, cs))
+}
+
+func HandleFuncBuilds(mux *http.ServeMux, path string, fn func(w http.ResponseWriter, r *http.Request, c *Config, b BuildStore) error, cs *ConfigStore, b BuildStore) {
+	mux.HandleFunc(path, buildsHandler(fn, cs, b))
+}
+
+func configHandler(fn func(w http.ResponseWriter, r *http.Request, c *Config) error, cs *ConfigStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r, cs.Config())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
-	})
+	}
+}
+
+func cachedHandler(fn func(w http.ResponseWriter, r *http.Request, c *Config, rc *RepositoryCache) error, cs *ConfigStore, rc *RepositoryCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r, cs.Config(), rc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func buildsHandler(fn func(w http.ResponseWriter, r *http.Request, c *Config, b BuildStore) error, cs *ConfigStore, b BuildStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r, cs.Config(), b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
 }
 
-func RegisterRoutes(config *Config, stats *RuntimeStats) {
+// RegisterRoutes adds the public endpoints to mux.
+func RegisterRoutes(mux *http.ServeMux, configs *ConfigStore, stats *RuntimeStats, events *EventQueue, builds BuildStore, repos *RepositoryCache, ready *Readiness) {
 	// GitHub Post-Receive requests
-	HandleFuncConfig("/_github", githubHandler, config)
+	mux.HandleFunc("/_github", func(w http.ResponseWriter, r *http.Request) {
+		err := githubHandler(w, r, configs.Config(), stats, events)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
 	// Hubot API
-	HandleFuncConfig("/_hubot", hubotHandler, config)
+	HandleFuncBuilds(mux, "/_hubot", hubotHandler, configs, builds)
 	// Jenkins callback
-	HandleFuncConfig("/_builder", builderHandler, config)
+	HandleFuncBuilds(mux, "/_builder", builderHandler, configs, builds)
+	// Jenkins job provisioning
+	HandleFuncConfig(mux, "/_setup", setupHandler, configs)
+	// GitHub webhook reconciliation
+	HandleFuncConfig(mux, "/_reconcile", reconcileHandler, configs)
+	// Configuration reload
+	mux.HandleFunc("/_reload", func(w http.ResponseWriter, r *http.Request) {
+		err := reloadHandler(w, r, configs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	// GitHub OAuth sign in for the web UI
+	HandleFuncConfig(mux, loginPath, loginHandler, configs)
+	HandleFuncConfig(mux, callbackPath, callbackHandler, configs)
+	HandleFuncConfig(mux, logoutPath, logoutHandler, configs)
 
 	// Organisations repository listing
-	HandleFuncConfig("/repositories", repositoryHandler, config)
+	mux.HandleFunc("/repositories", requireSession(configs, cachedHandler(repositoryHandler, configs, repos)))
+	mux.HandleFunc("/repositories"+jsonSuffix, requireSession(configs, cachedHandler(repositoryHandler, configs, repos)))
+	// Per-repository build history
+	mux.HandleFunc("/repositories/", requireSession(configs, buildsHandler(repositoryBuildsHandler, configs, builds)))
 
-	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		statusHandler(w, r, config, stats)
+	// Load balancer readiness probe
+	mux.HandleFunc("/_ready", func(w http.ResponseWriter, r *http.Request) {
+		readyHandler(w, r, ready)
 	})
 
 	// landing page
-	HandleFuncConfig("/", rootHandler, config)
+	mux.HandleFunc("/", requireSession(configs, cachedHandler(rootHandler, configs, repos)))
+}
+
+// RegisterOperationalRoutes adds /status, /metrics and pprof to mux. They
+// always require admin credentials on the public listener, on a dedicated
+// admin listener only when credentials are configured.
+func RegisterOperationalRoutes(mux *http.ServeMux, configs *ConfigStore, stats *RuntimeStats, public bool) {
+	guard := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			admin := configs.Config().Admin
+			if admin.HasCredentials() {
+				if !adminAuthorized(w, r, admin) {
+					return
+				}
+			} else if public {
+				http.Error(w, "Admin configuration is invalid.", http.StatusForbidden)
+				return
+			}
+			h(w, r)
+		}
+	}
+
+	mux.HandleFunc("/status", guard(func(w http.ResponseWriter, r *http.Request) {
+		statusHandler(w, r, configs.Config(), stats)
+	}))
+	// Prometheus scrape target
+	mux.HandleFunc("/metrics", guard(func(w http.ResponseWriter, r *http.Request) {
+		err := metricsHandler(w, r, stats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+
+	mux.HandleFunc("/debug/pprof/", guard(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", guard(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", guard(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", guard(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", guard(pprof.Trace))
 }
 
-func ListenAndServe(address, cert, key string, handler http.Handler) (err error) {
+// NewServer is the HTTP server for config with its timeouts applied.
+func NewServer(config *Config, handler http.Handler) (*http.Server, error) {
+	read, err := config.ReadTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	write, err := config.WriteTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	idle, err := config.IdleTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Server{
+		Addr:              config.Address,
+		Handler:           handler,
+		ReadTimeout:       read,
+		ReadHeaderTimeout: read,
+		WriteTimeout:      write,
+		IdleTimeout:       idle,
+		MaxHeaderBytes:    config.MaxHeaderBytes(),
+	}, nil
+}
+
+// NewAdminServer is the operational listener on admin.address. It has no
+// write timeout so pprof profiles and traces may run longer than page requests.
+func NewAdminServer(config *Config, handler http.Handler) (*http.Server, error) {
+	srv, err := NewServer(config, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	srv.Addr = config.Admin.Address
+	srv.WriteTimeout = 0
+
+	return srv, nil
+}
+
+// Serve listens until the server is shut down, returning nil once it has been.
+func Serve(srv *http.Server, cert, key string) (err error) {
 	if key != "" && cert != "" {
-		err = http.ListenAndServeTLS(address, cert, key, handler)
+		err = srv.ListenAndServeTLS(cert, key)
 	} else {
-		err = http.ListenAndServe(address, handler)
+		err = srv.ListenAndServe()
+	}
+
+	if err == http.ErrServerClosed {
+		return nil
 	}
 
 	return
 }
+
+// Readiness reports whether Lanky should receive traffic, it fails once draining starts.
+type Readiness struct {
+	draining int32
+}
+
+func (rd *Readiness) Drain()      { atomic.StoreInt32(&rd.draining, 1) }
+func (rd *Readiness) Ready() bool { return atomic.LoadInt32(&rd.draining) == 0 }
+
+func readyHandler(w http.ResponseWriter, r *http.Request, ready *Readiness) {
+	if !ready.Ready() {
+		http.Error(w, "Draining", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprint(w, "OK")
+}
+
+// shutdown fails readiness, waits ShutdownDelay for load balancers to notice,
+// then stops accepting connections and drains in-flight requests and queued
+// events. Everything must finish within ShutdownTimeout of the signal.
+func shutdown(config *Config, servers []*http.Server, events *EventQueue, ready *Readiness, stop chan struct{}) error {
+	delay, err := config.ShutdownDelay()
+	if err != nil {
+		return err
+	}
+
+	timeout, err := config.ShutdownTimeout()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	ready.Drain()
+	close(stop)
+	time.Sleep(delay)
+
+	for _, srv := range servers {
+		err = srv.Shutdown(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return events.Drain(time.Until(deadline))
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func Test_ensure_WriteHeader_writes_to_embedded_struct(t *testing.T) {
@@ -20,5 +22,149 @@ func Test_ensure_WriteHeader_writes_to_embedded_struct(t *testing.T) {
 	}
 }
 
+var routesTable = []struct {
+	path    string
+	pattern string
+}{
+	{"/_github", "/_github"},
+	{"/_builder", "/_builder"},
+	{"/_ready", "/_ready"},
+	{"/_login", "/_login"},
+	{"/_oauth/callback", "/_oauth/callback"},
+	{"/repositories/baxterthehacker/public-repo", "/repositories/"},
+	{"/debug/pprof/heap", "/"},
+	{"/status", "/"},
+}
+
 func Test_RegisterRoutes_should_map_expected_routes(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewConfigStore("", noEnv, &Config{}), NewStats(), newEvents(), nil, NewRepositoryCache(), &Readiness{})
+
+	for _, tt := range routesTable {
+		r, _ := http.NewRequest("GET", "http://localhost:9393"+tt.path, nil)
+		_, pattern := mux.Handler(r)
+		if pattern != tt.pattern {
+			t.Fatalf("mux.Handler(%v) pattern = %v, want %v", tt.path, pattern, tt.pattern)
+		}
+	}
+}
+
+var operationalAuthTable = []struct {
+	admin    *Admin
+	public   bool
+	auth     string
+	expected int
+}{
+	{nil, true, "", http.StatusForbidden},
+	{nil, false, "", http.StatusOK},
+	{&Admin{Token: "t0ken"}, false, "", http.StatusUnauthorized},
+	{&Admin{Token: "t0ken"}, true, "Bearer wrong", http.StatusUnauthorized},
+	{&Admin{Token: "t0ken"}, true, "Bearer t0ken", http.StatusOK},
+	{&Admin{User: "admin", Password: "secret"}, true, "Basic YWRtaW46c2VjcmV0", http.StatusOK},
+}
+
+func Test_RegisterOperationalRoutes_should_guard_endpoints(t *testing.T) {
+	for i, tt := range operationalAuthTable {
+		mux := http.NewServeMux()
+		RegisterOperationalRoutes(mux, NewConfigStore("", noEnv, &Config{Admin: tt.admin}), NewStats(), tt.public)
+
+		r, _ := http.NewRequest("GET", "http://localhost:9393/metrics", nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != tt.expected {
+			t.Fatalf("%v: w.Code = %v, want %v", i, w.Code, tt.expected)
+		}
+	}
+}
+
+func Test_NewServer_should_apply_defaults_and_overrides(t *testing.T) {
+	srv, err := NewServer(&Config{Address: ":9393", Server: &Server{WriteTimeout: "1m"}}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if srv.ReadTimeout != defaultReadTimeout || srv.WriteTimeout != time.Minute || srv.IdleTimeout != defaultIdleTimeout {
+		t.Fatalf("srv timeouts = %v, %v, %v, want %v, %v, %v", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout, defaultReadTimeout, time.Minute, defaultIdleTimeout)
+	}
+
+	if srv.MaxHeaderBytes != defaultMaxHeaderBytes {
+		t.Fatalf("srv.MaxHeaderBytes = %v, want %v", srv.MaxHeaderBytes, defaultMaxHeaderBytes)
+	}
+}
+
+func Test_NewServer_with_invalid_timeout_should_return_error(t *testing.T) {
+	_, err := NewServer(&Config{Server: &Server{IdleTimeout: "forever"}}, http.NotFoundHandler())
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+}
+
+func Test_NewAdminServer_should_not_limit_writes(t *testing.T) {
+	config := &Config{Address: ":9393", Admin: &Admin{Address: "127.0.0.1:9394"}, Server: &Server{WriteTimeout: "1m"}}
+	srv, err := NewAdminServer(config, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if srv.Addr != "127.0.0.1:9394" || srv.WriteTimeout != 0 || srv.ReadTimeout != defaultReadTimeout {
+		t.Fatalf("srv = %v, %v, %v, want %v, 0, %v", srv.Addr, srv.WriteTimeout, srv.ReadTimeout, "127.0.0.1:9394", defaultReadTimeout)
+	}
+}
+
+func Test_readyHandler_should_fail_when_draining(t *testing.T) {
+	ready := &Readiness{}
+
+	for _, expected := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		r, _ := http.NewRequest("GET", "http://localhost:9393/_ready", nil)
+		w := httptest.NewRecorder()
+		readyHandler(w, r, ready)
+
+		if w.Code != expected {
+			t.Fatalf("w.Code = %v, want %v", w.Code, expected)
+		}
+		ready.Drain()
+	}
+}
+
+func Test_shutdown_should_drain_requests_and_events(t *testing.T) {
+	srv, _ := NewServer(&Config{Address: "127.0.0.1:0"}, http.NotFoundHandler())
+	served := make(chan error, 1)
+	go func() { served <- Serve(srv, "", "") }()
+
+	processed := make(chan struct{}, 1)
+	events := NewEventQueue(1, 1, newDeliveries(), NewStats(), func(e *Event) (string, error) {
+		processed <- struct{}{}
+		return "OK", nil
+	})
+	events.Enqueue(&Event{Type: "push", Delivery: "1"})
+
+	ready := &Readiness{}
+	stop := make(chan struct{})
+
+	err := shutdown(&Config{}, []*http.Server{srv}, events, ready, stop)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if err = <-served; err != nil {
+		t.Fatalf("Serve() = %v, want nil", err)
+	}
+
+	if ready.Ready() {
+		t.Fatalf("ready.Ready() = true, want false")
+	}
+
+	select {
+	case <-stop:
+	default:
+		t.Fatalf("stop is open, want closed")
+	}
+
+	if len(processed) != 1 {
+		t.Fatalf("len(processed) = %v, want %v", len(processed), 1)
+	}
 }
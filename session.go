@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie = "lanky_session"
+	stateCookie   = "lanky_oauth_state"
+
+	sessionLifetime  = 8 * time.Hour
+	stateLifetime    = 10 * time.Minute
+	minSessionSecret = 32
+
+	loginPath    = "/_login"
+	callbackPath = "/_oauth/callback"
+	logoutPath   = "/_logout"
+)
+
+// oauthScopes allow checking private organisation membership and listing the
+// private repositories a user can see.
+var oauthScopes = []string{"read:org", "repo"}
+
+var errInvalidCookie = errors.New("Cookie is invalid or expired.")
+
+// Session is the signed in user. It lives entirely in a sealed cookie so
+// Lanky keeps no session state.
+type Session struct {
+	Login   string
+	Token   string
+	Expires time.Time
+}
+
+type oauthState struct {
+	State   string
+	Return  string
+	Expires time.Time
+}
+
+type sessionContextKey struct{}
+
+// SessionFrom is the session of a request that passed requireSession, nil
+// when sign in is disabled or the request used admin credentials.
+func SessionFrom(r *http.Request) *Session {
+	s, _ := r.Context().Value(sessionContextKey{}).(*Session)
+	return s
+}
+
+// cookieCipher derives the AES-GCM key from the session secret. GCM
+// authenticates the cookie as well as hiding the user's token.
+func cookieCipher(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealCookie encrypts and signs v with name as additional data, so a value
+// cannot be replayed in another cookie.
+func sealCookie(secret, name string, v interface{}) (string, error) {
+	aead, err := cookieCipher(secret)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, b, []byte(name))), nil
+}
+
+func openCookie(secret, name, value string, v interface{}) error {
+	aead, err := cookieCipher(secret)
+	if err != nil {
+		return err
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) < aead.NonceSize() {
+		return errInvalidCookie
+	}
+
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return errInvalidCookie
+	}
+
+	return json.Unmarshal(plain, v)
+}
+
+func setCookie(w http.ResponseWriter, config *Config, name, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.BaseUrl, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(w http.ResponseWriter, config *Config, name string) {
+	setCookie(w, config, name, "", time.Unix(0, 0))
+}
+
+// readSession opens the session cookie, failing when it is missing, forged or expired.
+func readSession(r *http.Request, config *Config, now time.Time) (*Session, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	err = openCookie(config.SessionSecret, sessionCookie, c.Value, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !now.Before(s.Expires) {
+		return nil, errInvalidCookie
+	}
+
+	return s, nil
+}
+
+func oauthConfig(config *Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     config.Github.ClientId,
+		ClientSecret: config.Github.ClientSecret,
+		Endpoint:     config.Github.OAuthEndpoint(),
+		RedirectURL:  strings.TrimRight(config.BaseUrl, "/") + callbackPath,
+		Scopes:       oauthScopes,
+	}
+}
+
+// returnPath only allows redirects back to Lanky after signing in.
+func returnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// requireSession restricts h to signed in organisation members when sign in
+// is enabled. Admin credentials are accepted for API clients. Browsers are
+// sent to sign in, JSON clients get a 401.
+func requireSession(configs *ConfigStore, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := configs.Config()
+		if !config.Github.SignInEnabled() {
+			h(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "" && config.Admin.HasCredentials() {
+			if adminAuthorized(w, r, config.Admin) {
+				h(w, r)
+			}
+			return
+		}
+
+		s, err := readSession(r, config, time.Now())
+		if err != nil {
+			if wantsJson(r) {
+				http.Error(w, "Sign in required.", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, loginPath+"?return="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s)))
+	}
+}
+
+// loginHandler starts the OAuth web flow, remembering the state and return
+// path in a short lived cookie.
+func loginHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
+	if !config.Github.SignInEnabled() {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	state := &oauthState{
+		State:   hex.EncodeToString(nonce),
+		Return:  returnPath(r.URL.Query().Get("return")),
+		Expires: time.Now().Add(stateLifetime),
+	}
+
+	value, err := sealCookie(config.SessionSecret, stateCookie, state)
+	if err != nil {
+		return err
+	}
+
+	setCookie(w, config, stateCookie, value, state.Expires)
+	http.Redirect(w, r, oauthConfig(config).AuthCodeURL(state.State), http.StatusFound)
+
+	return nil
+}
+
+// callbackHandler completes the OAuth web flow and issues the session cookie
+// to members of the configured organisation.
+func callbackHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
+	if !config.Github.SignInEnabled() {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	state := &oauthState{}
+	c, err := r.Cookie(stateCookie)
+	if err == nil {
+		err = openCookie(config.SessionSecret, stateCookie, c.Value, state)
+	}
+	clearCookie(w, config, stateCookie)
+
+	q := r.URL.Query()
+	if err != nil || !time.Now().Before(state.Expires) || !secureCompare(q.Get("state"), state.State) {
+		http.Error(w, "Invalid OAuth state.", http.StatusBadRequest)
+		return nil
+	}
+
+	if q.Get("error") != "" {
+		http.Error(w, "Sign in was cancelled: "+q.Get("error"), http.StatusForbidden)
+		return nil
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, &http.Client{
+		Timeout:   config.ClientTimeout(),
+		Transport: &instrumentedTransport{"github", http.DefaultTransport},
+	})
+	token, err := oauthConfig(config).Exchange(ctx, q.Get("code"))
+	if err != nil {
+		return err
+	}
+
+	cl := NewGithubUser(config, token.AccessToken)
+	user := &Sender{}
+	err = cl.CurrentUser(user)
+	if err != nil {
+		return err
+	}
+
+	member, err := cl.IsMember(config.Github.Organization, user.Login)
+	if err != nil {
+		return err
+	}
+
+	if !member {
+		glog.Warningf("Sign in refused for %v, not a member of %v.", user.Login, config.Github.Organization)
+		http.Error(w, "Sign in is restricted to members of "+config.Github.Organization+".", http.StatusForbidden)
+		return nil
+	}
+
+	s := &Session{
+		Login:   user.Login,
+		Token:   token.AccessToken,
+		Expires: time.Now().Add(sessionLifetime),
+	}
+
+	value, err := sealCookie(config.SessionSecret, sessionCookie, s)
+	if err != nil {
+		return err
+	}
+
+	setCookie(w, config, sessionCookie, value, s.Expires)
+	http.Redirect(w, r, state.Return, http.StatusFound)
+
+	return nil
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request, config *Config) error {
+	clearCookie(w, config, sessionCookie)
+	http.Redirect(w, r, "/", http.StatusFound)
+	return nil
+}
+
+// visibleRepositories removes the private repositories the session's user
+// cannot access. Every repository is visible without a session.
+func visibleRepositories(config *Config, s *Session, all Repositories) (Repositories, error) {
+	if s == nil {
+		return all, nil
+	}
+
+	private := false
+	for i := range all {
+		private = private || all[i].Private
+	}
+	if !private {
+		return all, nil
+	}
+
+	accessible := make(Repositories, 0, userReposPageSize)
+	err := NewGithubUser(config, s.Token).ListUserRepositories(&accessible)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[int]bool, len(accessible))
+	for _, repo := range accessible {
+		allowed[repo.Id] = true
+	}
+
+	visible := make(Repositories, 0, len(all))
+	for _, repo := range all {
+		if !repo.Private || allowed[repo.Id] {
+			visible = append(visible, repo)
+		}
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+func Test_sealCookie_should_round_trip(t *testing.T) {
+	value, err := sealCookie(testSessionSecret, sessionCookie, &Session{Login: "octocat"})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	s := &Session{}
+	err = openCookie(testSessionSecret, sessionCookie, value, s)
+	if err != nil || s.Login != "octocat" {
+		t.Fatalf("openCookie() = %v %v, want octocat", s.Login, err)
+	}
+}
+
+var openCookieTable = []struct {
+	secret string
+	name   string
+	mangle func(string) string
+}{
+	{"another secret that is long enough!", sessionCookie, func(v string) string { return v }},
+	{testSessionSecret, stateCookie, func(v string) string { return v }},
+	{testSessionSecret, sessionCookie, func(v string) string { return v[:len(v)-2] + "AA" }},
+	{testSessionSecret, sessionCookie, func(v string) string { return "!" }},
+}
+
+func Test_openCookie_should_reject_forged_values(t *testing.T) {
+	value, _ := sealCookie(testSessionSecret, sessionCookie, &Session{Login: "octocat"})
+
+	for i, tt := range openCookieTable {
+		err := openCookie(tt.secret, tt.name, tt.mangle(value), &Session{})
+		if err != errInvalidCookie {
+			t.Fatalf("%v: err = %v, want %v", i, err, errInvalidCookie)
+		}
+	}
+}
+
+var returnPathTable = []struct {
+	in       string
+	expected string
+}{
+	{"/repositories?update=now", "/repositories?update=now"},
+	{"", "/"},
+	{"https://evil.example.com/", "/"},
+	{"//evil.example.com/", "/"},
+	{"/\\evil.example.com/", "/"},
+}
+
+func Test_returnPath_should_only_allow_local_paths(t *testing.T) {
+	for _, tt := range returnPathTable {
+		if actual := returnPath(tt.in); actual != tt.expected {
+			t.Fatalf("returnPath(%q) = %v, want %v", tt.in, actual, tt.expected)
+		}
+	}
+}
+
+var signInConfig = &Config{
+	BaseUrl:       "https://lanky.local",
+	SessionSecret: testSessionSecret,
+	Github:        &Github{ClientId: "client", ClientSecret: "secret", Organization: "baxterthehacker"},
+	Admin:         &Admin{Token: "t0ken"},
+}
+
+func sessionCookieFor(s *Session) *http.Cookie {
+	value, _ := sealCookie(testSessionSecret, sessionCookie, s)
+	return &http.Cookie{Name: sessionCookie, Value: value}
+}
+
+var requireSessionTable = []struct {
+	config   *Config
+	accept   string
+	auth     string
+	cookie   *http.Cookie
+	expected int
+	login    string
+}{
+	{&Config{}, "", "", nil, http.StatusOK, ""},
+	{signInConfig, "", "", nil, http.StatusFound, ""},
+	{signInConfig, jsonContentType, "", nil, http.StatusUnauthorized, ""},
+	{signInConfig, "", "Bearer t0ken", nil, http.StatusOK, ""},
+	{signInConfig, "", "Bearer wrong", nil, http.StatusUnauthorized, ""},
+	{signInConfig, "", "", sessionCookieFor(&Session{Login: "octocat", Expires: time.Now().Add(time.Hour)}), http.StatusOK, "octocat"},
+	{signInConfig, "", "", sessionCookieFor(&Session{Login: "octocat", Expires: time.Now().Add(-time.Hour)}), http.StatusFound, ""},
+}
+
+func Test_requireSession_should_guard_handler(t *testing.T) {
+	for i, tt := range requireSessionTable {
+		var login string
+		h := requireSession(NewConfigStore("", noEnv, tt.config), func(w http.ResponseWriter, r *http.Request) {
+			if s := SessionFrom(r); s != nil {
+				login = s.Login
+			}
+		})
+
+		r, _ := http.NewRequest("GET", "http://localhost:9393/repositories?update=now", nil)
+		r.Header.Set("Accept", tt.accept)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		if tt.cookie != nil {
+			r.AddCookie(tt.cookie)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != tt.expected || login != tt.login {
+			t.Fatalf("%v: w.Code, login = %v %q, want %v %q", i, w.Code, login, tt.expected, tt.login)
+		}
+
+		if w.Code == http.StatusFound && w.Header().Get("Location") != "/_login?return=%2Frepositories%3Fupdate%3Dnow" {
+			t.Fatalf("%v: Location = %v, want sign in with return path", i, w.Header().Get("Location"))
+		}
+	}
+}
+
+// newOAuthServer fakes the GitHub OAuth and API endpoints, members lists
+// the logins belonging to the organisation.
+func newOAuthServer(login string, members ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login/oauth/access_token":
+			w.Header().Set("Content-Type", jsonContentType)
+			fmt.Fprint(w, `{"access_token": "user-token", "token_type": "bearer"}`)
+		case r.URL.Path == "/api/user" && r.Header.Get("Authorization") == "Bearer user-token":
+			fmt.Fprintf(w, `{"login": %q}`, login)
+		case strings.HasPrefix(r.URL.Path, "/api/orgs/baxterthehacker/members/"):
+			for _, m := range members {
+				if r.URL.Path == "/api/orgs/baxterthehacker/members/"+m {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func oauthTestConfig(ts *httptest.Server) *Config {
+	c := *signInConfig
+	g := *signInConfig.Github
+	g.ApiUrl = ts.URL + "/api"
+	g.WebUrl = ts.URL
+	c.Github = &g
+	return &c
+}
+
+// signIn starts the flow with loginHandler and returns the callback response.
+func signIn(t *testing.T, config *Config, mangleState bool) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", "https://lanky.local/_login?return=/repositories", nil)
+	w := httptest.NewRecorder()
+	err := loginHandler(w, r, config)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	state := location.Query().Get("state")
+	if !strings.HasPrefix(location.String(), config.Github.WebBaseUrl()+"/login/oauth/authorize") || state == "" {
+		t.Fatalf("Location = %v, want authorize URL with state", location)
+	}
+	if mangleState {
+		state += "0"
+	}
+
+	r, _ = http.NewRequest("GET", "https://lanky.local/_oauth/callback?code=c0de&state="+state, nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	err = callbackHandler(w, r, config)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	return w
+}
+
+func Test_callbackHandler_should_sign_in_members(t *testing.T) {
+	ts := newOAuthServer("octocat", "octocat")
+	defer ts.Close()
+	config := oauthTestConfig(ts)
+
+	w := signIn(t, config, false)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/repositories" {
+		t.Fatalf("w.Code = %v %v, want %v to /repositories: %v", w.Code, w.Header().Get("Location"), http.StatusFound, w.Body)
+	}
+
+	r, _ := http.NewRequest("GET", "https://lanky.local/repositories", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	s, err := readSession(r, config, time.Now())
+	if err != nil || s.Login != "octocat" || s.Token != "user-token" {
+		t.Fatalf("readSession() = %+v %v, want octocat with user-token", s, err)
+	}
+}
+
+func Test_callbackHandler_should_refuse_non_members(t *testing.T) {
+	ts := newOAuthServer("mallory", "octocat")
+	defer ts.Close()
+
+	w := signIn(t, oauthTestConfig(ts), false)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func Test_callbackHandler_should_reject_mismatched_state(t *testing.T) {
+	ts := newOAuthServer("octocat", "octocat")
+	defer ts.Close()
+
+	w := signIn(t, oauthTestConfig(ts), true)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func Test_visibleRepositories_should_hide_inaccessible_private_repositories(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 2, "full_name": "baxterthehacker/private-repo", "private": true}]`)
+	}))
+	defer ts.Close()
+
+	config := &Config{Github: &Github{ApiUrl: ts.URL + "/api"}}
+	all := Repositories{
+		{Id: 1, FullName: "baxterthehacker/public-repo"},
+		{Id: 2, FullName: "baxterthehacker/private-repo", Private: true},
+		{Id: 3, FullName: "baxterthehacker/secret-repo", Private: true},
+	}
+
+	visible, err := visibleRepositories(config, &Session{Login: "octocat", Token: "user-token"}, all)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if len(visible) != 2 || visible[1].FullName != "baxterthehacker/private-repo" {
+		t.Fatalf("visible = %v, want public-repo and private-repo", visible)
+	}
+
+	visible, _ = visibleRepositories(config, nil, all)
+	if len(visible) != 3 {
+		t.Fatalf("len(visible) without session = %v, want %v", len(visible), 3)
+	}
+}
+
+func Test_NewGithubUser_should_not_share_rate_limit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "2")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(40*time.Minute).Unix()))
+		fmt.Fprint(w, `{"login": "octocat"}`)
+	}))
+	defer ts.Close()
+
+	before := githubRateLimit.Snapshot()
+
+	user := &Sender{}
+	err := NewGithubUser(&Config{Github: &Github{ApiUrl: ts.URL + "/api"}}, "user-token").CurrentUser(user)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if after := githubRateLimit.Snapshot(); after != before {
+		t.Fatalf("githubRateLimit = %+v, want unchanged %+v", after, before)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+)
+
+const defaultJobTemplate = `<?xml version='1.0' encoding='UTF-8'?>
+<project>
+  <description>{{.Repository.FullName | html}} - managed by Lanky.</description>
+  <keepDependencies>false</keepDependencies>
+  <properties>
+    <com.tikal.hudson.plugins.notification.HudsonNotificationProperty plugin="notification">
+      <endpoints>
+        <com.tikal.hudson.plugins.notification.Endpoint>
+          <protocol>HTTP</protocol>
+          <format>JSON</format>
+          <urlInfo>
+            <urlOrId>{{.NotifyUrl | html}}</urlOrId>
+            <urlType>PUBLIC</urlType>
+          </urlInfo>
+          <event>all</event>
+          <timeout>30000</timeout>
+          <loglines>0</loglines>
+        </com.tikal.hudson.plugins.notification.Endpoint>
+      </endpoints>
+    </com.tikal.hudson.plugins.notification.HudsonNotificationProperty>
+    <hudson.model.ParametersDefinitionProperty>
+      <parameterDefinitions>{{range .Parameters}}
+        <hudson.model.StringParameterDefinition>
+          <name>{{.}}</name>
+          <defaultValue></defaultValue>
+        </hudson.model.StringParameterDefinition>{{end}}
+      </parameterDefinitions>
+    </hudson.model.ParametersDefinitionProperty>
+  </properties>
+  <scm class="hudson.plugins.git.GitSCM" plugin="git">
+    <configVersion>2</configVersion>
+    <userRemoteConfigs>
+      <hudson.plugins.git.UserRemoteConfig>
+        <url>{{.Repository.SshUrl | html}}</url>
+        <refspec>+refs/heads/*:refs/remotes/origin/* +refs/pull/*:refs/remotes/origin/pull/*</refspec>
+      </hudson.plugins.git.UserRemoteConfig>
+    </userRemoteConfigs>
+    <branches>
+      <hudson.plugins.git.BranchSpec>
+        <name>${BRANCH}</name>
+      </hudson.plugins.git.BranchSpec>
+    </branches>
+  </scm>
+  <canRoam>true</canRoam>
+  <disabled>false</disabled>
+  <concurrentBuild>true</concurrentBuild>
+  <builders>
+    <hudson.tasks.Shell>
+      <command>case "$BRANCH" in
+  pull/*/merge) ;;
+  *) test -z "$SHA" || git checkout -qf "$SHA" ;;
+esac
+./script/cibuild</command>
+    </hudson.tasks.Shell>
+  </builders>
+  <publishers/>
+  <buildWrappers/>
+</project>
+`
+
+// jobParameters are the build parameters supplied by TriggerBuild.
+var jobParameters = []string{"SHA", "BRANCH", "REPOSITORY", "PUSHER", "CALLBACK_URL", "PR_NUMBER", "BASE_BRANCH"}
+
+type jobTemplateData struct {
+	Repository *Repository
+	NotifyUrl  string
+	Parameters []string
+}
+
+// JobTemplate returns the config.xml template from Jenkins.JobTemplate or the built-in default.
+func JobTemplate(config *Config) (t *template.Template, err error) {
+	text := defaultJobTemplate
+	if config.Jenkins != nil && config.Jenkins.JobTemplate != "" {
+		b, err := ioutil.ReadFile(config.Jenkins.JobTemplate)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	return template.New("job").Parse(text)
+}
+
+type SetupResult struct {
+	Repository string
+	Job        string
+	Created    bool
+	Err        error
+}
+
+func (sr *SetupResult) String() string {
+	switch {
+	case sr.Err != nil:
+		return fmt.Sprintf("error %v: %v", sr.Repository, sr.Err)
+	case sr.Created:
+		return fmt.Sprintf("created %v for %v", sr.Job, sr.Repository)
+	}
+	return fmt.Sprintf("exists %v for %v", sr.Job, sr.Repository)
+}
+
+// SetupRepositories creates a Jenkins job for each named organisation repository,
+// or every repository when names is empty. Jobs that already exist are skipped.
+func SetupRepositories(config *Config, names []string) (results []*SetupResult, err error) {
+	cl := NewGithub(config)
+	if cl == nil {
+		return nil, errors.New("Github configuration is invalid.")
+	}
+
+	j := NewJenkins(config)
+	if j == nil {
+		return nil, errors.New("Jenkins configuration is invalid.")
+	}
+
+	t, err := JobTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+
+	reps := make(Repositories, 0, 100)
+	err = cl.ListRepositories(config.Github.Organization, &reps)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := reps
+	if len(names) > 0 {
+		selected = make(Repositories, 0, len(names))
+		for _, name := range names {
+			i := findRepository(reps, config.Github.Organization, name)
+			if i == -1 {
+				results = append(results, &SetupResult{Repository: name, Err: errors.New("not found in organization")})
+				continue
+			}
+			selected = append(selected, reps[i])
+		}
+	}
+
+	for i := range selected {
+		results = append(results, setupRepository(j, t, &selected[i]))
+	}
+
+	return results, nil
+}
+
+func findRepository(reps Repositories, org, name string) int {
+	for i := range reps {
+		if reps[i].Name == name || reps[i].FullName == name || reps[i].FullName == org+"/"+name {
+			return i
+		}
+	}
+	return -1
+}
+
+func setupRepository(j *JenkinsClient, t *template.Template, repo *Repository) *SetupResult {
+	result := &SetupResult{
+		Repository: repo.FullName,
+		Job:        repo.JobName(),
+	}
+
+	exists, err := j.JobExists(result.Job)
+	if err != nil || exists {
+		result.Err = err
+		return result
+	}
+
+	data := &jobTemplateData{
+		Repository: repo,
+		NotifyUrl:  j.Config.NotifyUrl(),
+		Parameters: jobParameters,
+	}
+
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Err = j.CreateJob(result.Job, buf)
+	result.Created = result.Err == nil
+	return result
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var setupRepo = &Repository{
+	Id:       1296269,
+	Name:     "Hello-World",
+	FullName: "octocat/Hello-World",
+	SshUrl:   "git@github.com:octocat/Hello-World.git",
+}
+
+type fakeJenkins struct {
+	jobs    map[string]bool
+	created map[string]string
+}
+
+func (fj *fakeJenkins) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/createItem" {
+		b, _ := ioutil.ReadAll(r.Body)
+		fj.created[r.URL.Query().Get("name")] = string(b)
+		return
+	}
+
+	for job := range fj.jobs {
+		if r.URL.Path == "/job/"+job+"/api/json" {
+			w.Write([]byte("{}"))
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func newFakeJenkins(jobs ...string) (*fakeJenkins, *httptest.Server, *JenkinsClient) {
+	fj := &fakeJenkins{
+		jobs:    make(map[string]bool),
+		created: make(map[string]string),
+	}
+	for _, job := range jobs {
+		fj.jobs[job] = true
+	}
+
+	ts := httptest.NewServer(fj)
+	config := &Config{
+		BaseUrl: "http://lanky.local",
+		Jenkins: &Jenkins{
+			BaseUrl:      ts.URL,
+			TrayFeed:     "/cc.xml",
+			NotifySecret: "abc&123",
+		},
+	}
+
+	return fj, ts, NewJenkins(config)
+}
+
+func Test_JobTemplate_default_should_render_valid_xml(t *testing.T) {
+	tmpl, err := JobTemplate(&Config{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	data := &jobTemplateData{
+		Repository: setupRepo,
+		NotifyUrl:  "http://lanky.local/_builder?token=a&b",
+		Parameters: jobParameters,
+	}
+
+	buf := &strings.Builder{}
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	var v struct{}
+	err = xml.Unmarshal([]byte(buf.String()), &v)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if !strings.Contains(buf.String(), "<name>CALLBACK_URL</name>") {
+		t.Fatal("template does not contain CALLBACK_URL parameter")
+	}
+}
+
+func Test_JobTemplate_should_read_configured_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	err := ioutil.WriteFile(path, []byte("<project>{{.Repository.Name}}</project>"), 0600)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	tmpl, err := JobTemplate(&Config{Jenkins: &Jenkins{JobTemplate: path}})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	buf := &strings.Builder{}
+	tmpl.Execute(buf, &jobTemplateData{Repository: setupRepo})
+
+	expected := "<project>Hello-World</project>"
+	if buf.String() != expected {
+		t.Fatalf("buf = %v, want %v", buf.String(), expected)
+	}
+}
+
+func Test_JobTemplate_with_missing_file_should_return_error(t *testing.T) {
+	_, err := JobTemplate(&Config{Jenkins: &Jenkins{JobTemplate: filepath.Join(os.TempDir(), "missing-lanky.xml")}})
+	if err == nil {
+		t.Fatal("err = nil, want error")
+	}
+}
+
+func Test_setupRepository_should_create_missing_job(t *testing.T) {
+	fj, ts, j := newFakeJenkins()
+	defer ts.Close()
+
+	tmpl, _ := JobTemplate(j.Config)
+	result := setupRepository(j, tmpl, setupRepo)
+	if result.Err != nil {
+		t.Fatalf("result.Err = %v, want nil", result.Err)
+	}
+
+	if !result.Created {
+		t.Fatal("result.Created = false, want true")
+	}
+
+	configXml, ok := fj.created["Hello-World-1296269"]
+	if !ok {
+		t.Fatal("job Hello-World-1296269 was not created")
+	}
+
+	expectedNotify := "http://lanky.local/_builder?token=abc%26123"
+	if !strings.Contains(configXml, expectedNotify) {
+		t.Fatalf("config.xml does not contain %v", expectedNotify)
+	}
+}
+
+func Test_setupRepository_should_skip_existing_job(t *testing.T) {
+	fj, ts, j := newFakeJenkins("Hello-World-1296269")
+	defer ts.Close()
+
+	tmpl, _ := JobTemplate(j.Config)
+	result := setupRepository(j, tmpl, setupRepo)
+	if result.Err != nil {
+		t.Fatalf("result.Err = %v, want nil", result.Err)
+	}
+
+	if result.Created {
+		t.Fatal("result.Created = true, want false")
+	}
+
+	if len(fj.created) != 0 {
+		t.Fatalf("len(fj.created) = %v, want 0", len(fj.created))
+	}
+
+	expected := "exists Hello-World-1296269 for octocat/Hello-World"
+	if result.String() != expected {
+		t.Fatalf("result.String() = %v, want %v", result.String(), expected)
+	}
+}
+
+func Test_findRepository(t *testing.T) {
+	reps := Repositories{*setupRepo}
+
+	for _, name := range []string{"Hello-World", "octocat/Hello-World"} {
+		if findRepository(reps, "octocat", name) != 0 {
+			t.Fatalf("findRepository(%v) = -1, want 0", name)
+		}
+	}
+
+	if findRepository(reps, "octocat", "Spoon-Knife") != -1 {
+		t.Fatal("findRepository(Spoon-Knife) = 0, want -1")
+	}
+}
+
+func Test_SetupRepositories_with_invalid_config_should_return_error(t *testing.T) {
+	_, err := SetupRepositories(&Config{}, nil)
+
+	expected := "Github configuration is invalid."
+	if err == nil || err.Error() != expected {
+		t.Fatalf("err = %v, want %v", err, expected)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// layoutHtml wraps every page, pages supply the "content" and optional "style" templates.
+const layoutHtml = `{{define "layout"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Lanky</title>
+<link href="//fonts.googleapis.com/css?family=Raleway:400,300,600" rel="stylesheet" type="text/css">
+<style>
+html {
+	font-size:62.5%;
+}
+body {
+	color:#222;
+	font-family: Raleway, HelveticaNeue, 'Helvetica Neue', Helvetica, Arial, sans-serif;
+	font-size:1.5em;
+	margin:1rem auto;
+	position:relative;
+	width:960px;
+}
+ul {
+	margin:0;
+	padding:0;
+}
+li {
+	list-style:none;
+	line-height:4rem;
+	height:4rem;
+	margin-bottom:1px;
+}
+a {
+	color:#1EAEDB;
+}
+ul a {
+	background:#eee;
+	display:block;
+	text-decoration:none;
+	text-indent:1rem;
+}
+th {
+	text-align:left;
+}
+.number {
+	text-align:right;
+}
+{{block "style" .}}{{end}}</style>
+</head>
+<body>
+{{template "content" .}}
+</body>
+</html>{{end}}`
+
+const statusHtml = `{{define "style"}}.key {
+	min-width:10rem;
+}
+{{end}}{{define "content"}}<h1>Lanky</h1>
+<table>
+<tr><th class=key>Key</th><th>Value</th></tr>
+<tr><td>Started</td><td>{{.StartDate}}</td></tr>
+<tr><td>Version</td><td class=number>{{.Version}}</td></tr>
+<tr><td># Goroutines</td><td class=number>{{.NumGoroutine}}</td></tr>
+<tr><td>1XX</td><td class=number>{{.Status1xx}}</td></tr>
+<tr><td>2XX</td><td class=number>{{.Status2xx}}</td></tr>
+<tr><td>3XX</td><td class=number>{{.Status3xx}}</td></tr>
+<tr><td>4XX</td><td class=number>{{.Status4xx}}</td></tr>
+<tr><td>5XX</td><td class=number>{{.Status5xx}}</td></tr>
+<tr><td>SHA-256 Signatures</td><td class=number>{{.SignatureSha256}}</td></tr>
+<tr><td>SHA-1 Signatures</td><td class=number>{{.SignatureSha1}}</td></tr>
+<tr><td>Queued Events</td><td class=number>{{.QueueDepth}}</td></tr>
+<tr><td>Processed Events</td><td class=number>{{.EventsProcessed}}</td></tr>
+<tr><td>Failed Events</td><td class=number>{{.EventsFailed}}</td></tr>
+{{with .GithubRateLimit}}{{if .Known}}<tr><td>GitHub Quota</td><td class=number>{{.Remaining}} / {{.Limit}}</td></tr>
+<tr><td>GitHub Quota Reset</td><td class=number>{{.ResetIn}}</td></tr>
+{{end}}{{end}}{{range .SecretMatches}}<tr><td>Secret {{.Name}}</td><td class=number>{{.Count}}</td></tr>
+{{end}}<tr><td>Bytes from System</td><td class=number>{{.Sys}}</td></tr>
+<tr><td>Heap in Use</td><td class=number>{{.HeapInuse}}</td></tr>
+<tr><td>Heap System</td><td class=number>{{.HeapSys}}</td></tr>
+<tr><td>Total Allocation</td><td class=number>{{.TotalAlloc}}</td></tr>
+</table>{{end}}`
+
+const rootHtml = `{{define "style"}}.Success a {
+	background:#517F1A;
+	color:white;
+}
+.Failure a {
+	background:#B2123F;
+	color:white;
+}
+a:hover {
+	background:#ccc;
+}
+{{end}}{{define "content"}}<h1>Lanky</h1>
+<p>Last {{.Len}} builds sorted by:
+{{if .ByDate}}
+date, <a href="?by=status">status</a>
+{{else}}
+<a href="?by=date">date</a>, status
+{{end}}
+</p>
+<ul>
+{{range .Project}}
+<li class="{{.LastBuildStatus}}"><a href="{{.ConsoleUrl}}">{{.BuildTime}} - {{.Name}} (#{{.LastBuildLabel}})</a>
+{{end}}
+</ul>{{end}}`
+
+const repositoryHtml = `{{define "style"}}.error {
+	color:#B22222;
+}
+{{end}}{{define "content"}}<h1>Lanky</h1>
+<p>{{.Repositories.Len}} repositories.</p>
+<p>{{if .Loaded}}Refreshed {{.UpdatedAt.Format "2006-01-02 15:04"}}.{{else}}Not loaded yet.{{end}}</p>
+{{with .Error}}<p class=error>Refresh failed at {{$.FailedAt.Format "2006-01-02 15:04"}}: {{.}}</p>
+{{end}}<ul>
+{{range .Repositories}}
+<li><a href="/repositories/{{.FullName}}">{{.FullName}}</a>
+{{end}}
+</ul>{{end}}`
+
+const buildsHtml = `{{define "style"}}table {
+	width:100%;
+}
+td {
+	line-height:3rem;
+}
+.success {
+	color:#2E8B57;
+}
+.failure, .error {
+	color:#B22222;
+}
+{{end}}{{define "content"}}<h1><a href="/repositories">Lanky</a> / {{.Repository}}</h1>
+<form method="get">
+<input type="text" name="branch" placeholder="branch" value="{{.Filter.Branch}}">
+<select name="status">
+<option value="">any status</option>
+{{range .Statuses}}<option{{if eq . $.Filter.Status}} selected{{end}}>{{.}}</option>
+{{end}}</select>
+<input type="submit" value="Filter">
+</form>
+<p>{{len .Builds}} builds.</p>
+<table>
+<tr><th>Branch</th><th>SHA</th><th>Author</th><th class=number>Duration</th><th>Status</th><th>Console</th></tr>
+{{range .Builds}}<tr><td>{{.Branch}}</td><td>{{if .Sha}}<a href="{{$.WebUrl}}/{{.Repository}}/commit/{{.Sha}}"><code>{{.ShortSha}}</code></a>{{end}}</td><td>{{.Pusher}}</td><td class=number>{{if .Duration}}{{.Duration}}{{end}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{if .ConsoleUrl}}<a href="{{.ConsoleUrl}}">#{{.Number}}</a>{{end}}</td></tr>
+{{end}}</table>{{end}}`
+
+const (
+	layoutFile  = "layout.html"
+	partialsDir = "partials"
+)
+
+// pageTemplates are the built-in pages keyed by name. A file named
+// {name}.html in the templates directory replaces the built-in.
+var pageTemplates = map[string]string{
+	"status":     statusHtml,
+	"root":       rootHtml,
+	"repository": repositoryHtml,
+	"builds":     buildsHtml,
+}
+
+// templates renders the HTML pages, main configures it from TemplatesDir.
+var templates = mustTemplates(NewTemplates("", false))
+
+// Templates are the HTML pages built from the layout, any partials and the
+// page content, optionally reloaded when a file in the directory changes.
+type Templates struct {
+	sync.RWMutex
+	dir    string
+	reload bool
+	loaded time.Time
+	pages  map[string]*template.Template
+}
+
+// NewTemplates loads the pages with overrides from dir when it is not empty.
+func NewTemplates(dir string, reload bool) (*Templates, error) {
+	t := &Templates{}
+
+	err := t.Configure(dir, reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func mustTemplates(t *Templates, err error) *Templates {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Configure replaces the pages with those loaded from dir, keeping the
+// current pages when any template is invalid.
+func (t *Templates) Configure(dir string, reload bool) error {
+	loaded := time.Now()
+
+	pages, err := loadPages(dir)
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	t.dir = dir
+	t.reload = reload
+	t.loaded = loaded
+	t.pages = pages
+	t.Unlock()
+
+	return nil
+}
+
+// Execute renders the named page to w.
+func (t *Templates) Execute(w io.Writer, name string, data interface{}) error {
+	t.RLock()
+	dir, reload, loaded := t.dir, t.reload, t.loaded
+	t.RUnlock()
+
+	if reload && modified(dir, loaded) {
+		attempted := time.Now()
+		err := t.Configure(dir, reload)
+		if err != nil {
+			glog.Errorf("Unable to reload templates from %v: %v", dir, err)
+			// keep the current pages until the next change rather than re-parsing every request
+			t.Lock()
+			if t.loaded.Before(attempted) {
+				t.loaded = attempted
+			}
+			t.Unlock()
+		}
+	}
+
+	t.RLock()
+	page, ok := t.pages[name]
+	t.RUnlock()
+	if !ok {
+		return fmt.Errorf("Template %v does not exist.", name)
+	}
+
+	return page.ExecuteTemplate(w, "layout", data)
+}
+
+func loadPages(dir string) (map[string]*template.Template, error) {
+	layout, err := source(dir, layoutFile, layoutHtml)
+	if err != nil {
+		return nil, err
+	}
+
+	var partials []string
+	if dir != "" {
+		partials, err = filepath.Glob(filepath.Join(dir, partialsDir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pages := make(map[string]*template.Template, len(pageTemplates))
+	for name, builtin := range pageTemplates {
+		content, err := source(dir, name+".html", builtin)
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := template.New(name).Parse(layout)
+		if err != nil {
+			return nil, fmt.Errorf("%v in layout.", err)
+		}
+
+		if len(partials) > 0 {
+			page, err = page.ParseFiles(partials...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		page, err = page.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("%v in %v page.", err, name)
+		}
+
+		pages[name] = page
+	}
+
+	return pages, nil
+}
+
+// source reads the named override from the templates directory or returns the built-in.
+func source(dir, name, builtin string) (string, error) {
+	if dir == "" {
+		return builtin, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return builtin, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// modified reports whether any file in dir changed since loaded.
+func modified(dir string, loaded time.Time) bool {
+	if dir == "" {
+		return false
+	}
+
+	changed := false
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(loaded) {
+			changed = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return changed
+}
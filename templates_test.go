@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTemplate(t *testing.T, path, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func Test_Templates_should_render_builtin_pages_in_layout(t *testing.T) {
+	var b bytes.Buffer
+	err := templates.Execute(&b, "repository", &RepositorySnapshot{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	for _, expected := range []string{"<!DOCTYPE html>", "<style>", "<p>0 repositories.</p>"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Fatalf("b.String() = %v, want to contain %v", b.String(), expected)
+		}
+	}
+}
+
+func Test_Templates_should_return_error_for_unknown_page(t *testing.T) {
+	var b bytes.Buffer
+	err := templates.Execute(&b, "missing", nil)
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+}
+
+func Test_Templates_should_load_overrides_and_partials(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, partialsDir), 0755)
+	writeTemplate(t, filepath.Join(dir, "repository.html"), `{{define "content"}}{{template "count" .}}{{end}}`)
+	writeTemplate(t, filepath.Join(dir, partialsDir, "count.html"), `{{define "count"}}<em>{{.Len}} repos</em>{{end}}`)
+
+	tmpl, err := NewTemplates(dir, false)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, "repository", Repositories{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if !strings.Contains(b.String(), "<em>0 repos</em>") || !strings.Contains(b.String(), "<!DOCTYPE html>") {
+		t.Fatalf("b.String() = %v, want override within layout", b.String())
+	}
+}
+
+func Test_Templates_should_reject_invalid_override(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, filepath.Join(dir, layoutFile), `{{define "layout"}}{{.Missing`)
+
+	_, err := NewTemplates(dir, false)
+	if err == nil {
+		t.Fatalf("err = nil, want error")
+	}
+}
+
+func Test_Templates_should_reload_changed_files(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repository.html")
+	writeTemplate(t, path, `{{define "content"}}before{{end}}`)
+
+	tmpl, err := NewTemplates(dir, true)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	writeTemplate(t, path, `{{define "content"}}after{{end}}`)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, "repository", Repositories{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if !strings.Contains(b.String(), "after") {
+		t.Fatalf("b.String() = %v, want to contain %v", b.String(), "after")
+	}
+}
+
+func Test_Templates_should_not_retry_failed_reload_until_changed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repository.html")
+	writeTemplate(t, path, `{{define "content"}}before{{end}}`)
+
+	tmpl, err := NewTemplates(dir, true)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	writeTemplate(t, path, `{{define "content"}}{{.Missing`)
+	past := time.Now().Add(-time.Minute)
+	os.Chtimes(path, past, past)
+	tmpl.loaded = past.Add(-time.Minute)
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, "repository", &RepositorySnapshot{})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	if !strings.Contains(b.String(), "before") {
+		t.Fatalf("b.String() = %v, want to contain %v", b.String(), "before")
+	}
+
+	if modified(dir, tmpl.loaded) {
+		t.Fatalf("modified() = true after failed reload, want false")
+	}
+}